@@ -0,0 +1,98 @@
+package main
+
+import "strings"
+
+// Helpers that join station data with elevator/escalator outages (the accessibility features)
+
+// elevatorOutageCounts counts out-of-service elevators per station code
+// Escalator outages are ignored here: they don't stop step-free access.
+func elevatorOutageCounts(outages []ElevatorIncident) map[string]int {
+	counts := make(map[string]int)
+	for _, outage := range outages {
+		if outage.UnitType == "ELEVATOR" {
+			counts[outage.StationCode]++
+		}
+	}
+	return counts
+}
+
+// annotateEntrances marks each entrance with whether its station's elevators are all in service
+// An entrance shared by two station codes (transfer stations) needs both codes to be outage-free.
+func annotateEntrances(entrances []StationEntrance, outages []ElevatorIncident) []AccessibleEntrance {
+	elevatorsOut := elevatorOutageCounts(outages)
+
+	annotated := make([]AccessibleEntrance, 0, len(entrances))
+	for _, entrance := range entrances {
+		inService := elevatorsOut[entrance.StationCode1] == 0
+		if entrance.StationCode2 != "" && elevatorsOut[entrance.StationCode2] > 0 {
+			inService = false
+		}
+		annotated = append(annotated, AccessibleEntrance{StationEntrance: entrance, ElevatorsInService: inService})
+	}
+	return annotated
+}
+
+// stepFreeStations keeps the stations with no elevator out of service (/stations?stepfree=true)
+// Stricter than StepFreeAccessAvailable in stationAccessibility (false only once every elevator is down):
+// this list is for picking a station you can count on, so any outage leaves a station off.
+func stepFreeStations(stations []StationInfo, outages []ElevatorIncident) []StationInfo {
+	elevatorsOut := elevatorOutageCounts(outages)
+	stepFree := make([]StationInfo, 0, len(stations))
+	for _, station := range stations {
+		if elevatorsOut[station.Code] == 0 {
+			stepFree = append(stepFree, station)
+		}
+	}
+	return stepFree
+}
+
+// stationElevatorCounts estimates how many elevators each station has, since WMATA doesn't publish it:
+// the entrances jStationEntrances describes as elevators (Name or Description mentioning one), at least 1,
+// since every Metro station has an elevator. stationAccessibility raises it to the units out if that's more.
+func stationElevatorCounts(stations []StationInfo, entrances []StationEntrance) map[string]int {
+	counts := make(map[string]int, len(stations))
+	for _, station := range stations {
+		counts[station.Code] = 0
+	}
+	for _, entrance := range entrances {
+		if !strings.Contains(strings.ToUpper(entrance.Name+" "+entrance.Description), "ELEVATOR") {
+			continue
+		}
+		counts[entrance.StationCode1]++
+		if entrance.StationCode2 != "" && entrance.StationCode2 != entrance.StationCode1 {
+			counts[entrance.StationCode2]++
+		}
+	}
+	for code, n := range counts {
+		counts[code] = max(n, 1)
+	}
+	return counts
+}
+
+// stationAccessibility summarises outages for every station, in station list order (/accessibility)
+// StepFreeAccessAvailable is false only when every elevator at the station is out. The total comes from
+// stationElevatorCounts, so a station with two elevator entrances and one outage still counts as step-free.
+func stationAccessibility(stations []StationInfo, entrances []StationEntrance, outages []ElevatorIncident) []StationAccessibility {
+	elevatorsOut := elevatorOutageCounts(outages)
+	elevators := stationElevatorCounts(stations, entrances)
+	escalatorsOut := make(map[string]int)
+	for _, outage := range outages {
+		if outage.UnitType == "ESCALATOR" {
+			escalatorsOut[outage.StationCode]++
+		}
+	}
+
+	statuses := make([]StationAccessibility, 0, len(stations))
+	for _, station := range stations {
+		total := max(elevators[station.Code], elevatorsOut[station.Code]) // More out than we knew of means there are more
+		statuses = append(statuses, StationAccessibility{
+			Code:                    station.Code,
+			Name:                    station.Name,
+			Elevators:               total,
+			ElevatorsOut:            elevatorsOut[station.Code],
+			EscalatorsOut:           escalatorsOut[station.Code],
+			StepFreeAccessAvailable: elevatorsOut[station.Code] < total,
+		})
+	}
+	return statuses
+}
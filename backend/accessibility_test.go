@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestStationAccessibilityNeedsEveryElevatorDown(t *testing.T) {
+	stations := []StationInfo{{Code: "A01"}, {Code: "A02"}, {Code: "A03"}, {Code: "A04"}}
+	entrances := []StationEntrance{
+		{StationCode1: "A01", Name: "NORTH (ELEVATOR)"},
+		{StationCode1: "A01", Description: "Elevator entrance on the south side"},
+		{StationCode1: "A01", Description: "Escalator entrance"},
+		{StationCode1: "A02", Description: "Elevator entrance"},
+		// A03 has no elevator entrance listed, so it's taken to have one; A04 has nothing out at all
+	}
+	elevator := func(code string) ElevatorIncident { return ElevatorIncident{StationCode: code, UnitType: "ELEVATOR"} }
+	outages := []ElevatorIncident{
+		elevator("A01"),                  // 1 of 2
+		elevator("A02"),                  // 1 of 1
+		elevator("A03"), elevator("A03"), // More out than the 1 assumed
+		{StationCode: "A04", UnitType: "ESCALATOR"}, // Escalators don't count
+	}
+
+	want := map[string]struct {
+		elevators, out int
+		stepFree       bool
+	}{
+		"A01": {2, 1, true},
+		"A02": {1, 1, false},
+		"A03": {2, 2, false},
+		"A04": {1, 0, true},
+	}
+	for _, status := range stationAccessibility(stations, entrances, outages) {
+		w := want[status.Code]
+		if status.Elevators != w.elevators || status.ElevatorsOut != w.out || status.StepFreeAccessAvailable != w.stepFree {
+			t.Errorf("%s: got %d elevators, %d out, step-free %v; want %d, %d, %v",
+				status.Code, status.Elevators, status.ElevatorsOut, status.StepFreeAccessAvailable, w.elevators, w.out, w.stepFree)
+		}
+	}
+
+	// ?stepfree=true stays strict: any elevator out leaves a station off
+	for _, station := range stepFreeStations(stations, outages) {
+		if station.Code != "A04" {
+			t.Errorf("stepFreeStations kept %s, which has an elevator out", station.Code)
+		}
+	}
+}
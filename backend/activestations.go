@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Prediction refresh strategies (PREDICTION_STRATEGY):
+//   - "all" (default): the background loop fetches GetPrediction/All every refresh, the whole system in one call.
+//   - "active": the loop only refreshes stations someone has asked /nexttrains about in the last activeStationWindow,
+//     via the per-station cache (see refreshStationPredictions). Far fewer WMATA calls for a quiet deployment.
+//     It goes back to "All" when too many stations are active, when someone asked for the unfiltered list (or the
+//     history / diff built from it), or while a /nexttrains/stream or /ws/predictions client is connected, since
+//     only the "All" refresh publishes to those and records history (see refreshTrainPredictions).
+const (
+	strategyAll    = "all"
+	strategyActive = "active"
+)
+
+var (
+	predictionStrategy  = strategyAll      // Overridable via PREDICTION_STRATEGY
+	activeStationWindow = 10 * time.Minute // A station stays active this long after its last request, overridable via ACTIVE_STATION_WINDOW
+	activeStationMax    = 20               // More active stations than this and "All" is cheaper, overridable via ACTIVE_STATION_MAX
+
+	activeStations     = make(map[string]time.Time) // Station code -> last requested
+	allStationsActive  time.Time                    // Last unfiltered /nexttrains request
+	predictionLoopRan  time.Time                    // Last successful background refresh, whichever strategy (for /health)
+	activeStationMutex sync.Mutex
+)
+
+// markStationsActive records that these stations were just requested (no-op under the "all" strategy)
+func markStationsActive(codes []string) {
+	if predictionStrategy != strategyActive {
+		return
+	}
+	activeStationMutex.Lock()
+	defer activeStationMutex.Unlock()
+	now := time.Now()
+	for _, code := range codes {
+		activeStations[code] = now
+	}
+}
+
+// markAllStationsActive records an unfiltered request, which needs the "All" refresh (no-op under "all")
+func markAllStationsActive() {
+	if predictionStrategy != strategyActive {
+		return
+	}
+	activeStationMutex.Lock()
+	defer activeStationMutex.Unlock()
+	allStationsActive = time.Now()
+}
+
+// activeStationCodes returns the stations requested within the window (sorted, so the WMATA URL is stable),
+// forgetting older ones, and whether the loop should fetch "All" instead (see the strategy notes above)
+func activeStationCodes() ([]string, bool) {
+	activeStationMutex.Lock()
+	defer activeStationMutex.Unlock()
+
+	var codes []string
+	for code, lastRequested := range activeStations {
+		if time.Since(lastRequested) > activeStationWindow {
+			delete(activeStations, code)
+			continue
+		}
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	all := time.Since(allStationsActive) <= activeStationWindow || len(codes) > activeStationMax ||
+		predictionUpdates.Count() > 0 // Stream subscribers only get "All" refreshes
+	return codes, all
+}
+
+// refreshPredictionsByStrategy is what the background prediction loop runs (see prewarmCaches)
+func refreshPredictionsByStrategy(ctx context.Context, apiKey string) error {
+	if predictionStrategy != strategyActive {
+		if _, err := refreshTrainPredictions(ctx, apiKey); err != nil {
+			return err
+		}
+		markPredictionLoopRan()
+		return nil
+	}
+
+	codes, all := activeStationCodes()
+	switch {
+	case all:
+		if _, err := refreshTrainPredictions(ctx, apiKey); err != nil {
+			return err
+		}
+	case len(codes) > 0:
+		if err := refreshStationPredictions(ctx, apiKey, codes); err != nil {
+			return err
+		}
+	default:
+		slog.Debug("[Predictions] no active stations, skipping refresh")
+	}
+	markPredictionLoopRan()
+	return nil
+}
+
+// markPredictionLoopRan records a successful (or deliberately skipped) background refresh
+func markPredictionLoopRan() {
+	activeStationMutex.Lock()
+	defer activeStationMutex.Unlock()
+	predictionLoopRan = time.Now()
+}
+
+// lastPredictionLoopRun returns when the background prediction loop last succeeded
+func lastPredictionLoopRun() time.Time {
+	activeStationMutex.Lock()
+	defer activeStationMutex.Unlock()
+	return predictionLoopRan
+}
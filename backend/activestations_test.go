@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// resetActiveStations switches to the "active" strategy with nothing requested yet, restoring the old state afterwards
+func resetActiveStations(t *testing.T) {
+	savedStrategy := predictionStrategy
+	t.Cleanup(func() {
+		predictionStrategy = savedStrategy
+		activeStationMutex.Lock()
+		activeStations, allStationsActive = make(map[string]time.Time), time.Time{}
+		activeStationMutex.Unlock()
+	})
+	predictionStrategy = strategyActive
+	activeStationMutex.Lock()
+	activeStations, allStationsActive = make(map[string]time.Time), time.Time{}
+	activeStationMutex.Unlock()
+}
+
+func TestStreamSubscriberNeedsAllRefresh(t *testing.T) {
+	resetActiveStations(t)
+	markStationsActive([]string{"A01"})
+
+	if codes, all := activeStationCodes(); all || len(codes) != 1 {
+		t.Fatalf("before subscribing: codes %v, all %v, want [A01] and false", codes, all)
+	}
+
+	// An SSE/WebSocket client only sees "All" refreshes, so the loop has to fetch "All" while one is connected
+	updates := predictionUpdates.Subscribe()
+	if _, all := activeStationCodes(); !all {
+		t.Error("with a stream subscriber: all = false, want true")
+	}
+
+	predictionUpdates.Unsubscribe(updates)
+	if _, all := activeStationCodes(); all {
+		t.Error("after unsubscribing: all = true, want false")
+	}
+}
+
+func TestHistoryRequestNeedsAllRefresh(t *testing.T) {
+	resetActiveStations(t)
+	startFakeWMATA(t, fixtureWMATA(t))
+
+	var history []PredictionSnapshot
+	getJSON(t, "/nexttrains/history", &history)
+	if _, all := activeStationCodes(); !all {
+		t.Error("after /nexttrains/history: all = false, want true")
+	}
+}
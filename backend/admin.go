@@ -0,0 +1,23 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Admin-only endpoints (/admin/refresh), protected by a shared secret.
+// Clients send it as "Authorization: Bearer <token>". With no ADMIN_TOKEN set the admin endpoints are disabled.
+
+var adminToken = "" // Set via ADMIN_TOKEN, see main.go
+
+// checkAdminToken reports whether the request carries the admin token
+// subtle.ConstantTimeCompare takes the same time whether the first or the last byte differs,
+// so the token can't be guessed one character at a time by timing the responses.
+func checkAdminToken(r *http.Request) bool {
+	if adminToken == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
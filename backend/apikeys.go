@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// API key rotation. WMATA_API_KEY can be a comma-separated list of keys (each WMATA key has its own rate limit),
+// and fetchFromWMATA spreads calls across them round-robin. A key that gets a 429 (rate limited) or 401/403
+// (revoked) is skipped for a while and the call fails over to the next key. Each key has its own WMATA_RATE_LIMIT budget.
+// With a single key this is a pool of one, so nothing changes.
+
+var (
+	keyRateLimitedWait = 30 * time.Second // Skip a key this long after a 429
+	keyRejectedWait    = 10 * time.Minute // Skip a key this long after a 401/403 (probably revoked)
+
+	apiKeyPools     = make(map[string]*apiKeyPool) // Keyed by the raw (comma-separated) WMATA_API_KEY value
+	apiKeyPoolMutex sync.Mutex
+)
+
+// apiKeyPool is the parsed list of keys, plus each key's failure record
+type apiKeyPool struct {
+	mu   sync.Mutex
+	keys []*apiKeyState
+	next int // Round-robin position
+}
+
+// apiKeyState is one key and how it has been doing
+type apiKeyState struct {
+	value     string
+	failures  int           // Consecutive 429/401/403s, reset by a success
+	skipUntil time.Time     // Don't use this key before then (unless every key is being skipped)
+	limiter   *rate.Limiter // This key's WMATA budget, see waitForWMATABudget
+}
+
+// keyPoolFor returns the pool for a raw WMATA_API_KEY value, parsing it the first time
+// An empty value still gets a pool of one (empty) key, so the missing-key path behaves like it always did.
+// Pools are built on first use, after main.go has read WMATA_RATE_LIMIT, so each key's limiter gets that rate.
+func keyPoolFor(apiKey string) *apiKeyPool {
+	apiKeyPoolMutex.Lock()
+	defer apiKeyPoolMutex.Unlock()
+
+	if pool, ok := apiKeyPools[apiKey]; ok {
+		return pool
+	}
+	pool := &apiKeyPool{}
+	for _, key := range strings.Split(apiKey, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			pool.keys = append(pool.keys, &apiKeyState{value: key, limiter: newWMATALimiter(wmataRateLimit)})
+		}
+	}
+	if len(pool.keys) == 0 {
+		pool.keys = []*apiKeyState{{value: "", limiter: newWMATALimiter(wmataRateLimit)}}
+	}
+	apiKeyPools[apiKey] = pool
+	return pool
+}
+
+// size returns how many keys are in the pool (the most attempts one fetch will make)
+func (p *apiKeyPool) size() int {
+	return len(p.keys) // Never changes after keyPoolFor, no lock needed
+}
+
+// pick returns the next usable key, round-robin
+// If every key is being skipped, the one whose skip ends soonest is used rather than failing outright.
+func (p *apiKeyPool) pick() *apiKeyState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	soonest := p.keys[p.next]
+	for i := 0; i < len(p.keys); i++ {
+		key := p.keys[(p.next+i)%len(p.keys)]
+		if !now.Before(key.skipUntil) {
+			p.next = (p.next + i + 1) % len(p.keys)
+			return key
+		}
+		if key.skipUntil.Before(soonest.skipUntil) {
+			soonest = key
+		}
+	}
+	return soonest
+}
+
+// reportSuccess clears a key's failure record
+func (p *apiKeyPool) reportSuccess(key *apiKeyState) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key.failures = 0
+	key.skipUntil = time.Time{}
+}
+
+// reportFailure records a key problem (see isKeyProblem) and benches the key for a while
+func (p *apiKeyPool) reportFailure(key *apiKeyState, statusCode int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key.failures++
+	wait := keyRateLimitedWait
+	if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden {
+		wait = keyRejectedWait
+	}
+	key.skipUntil = time.Now().Add(wait)
+}
+
+// status reports each key for /health, by position only (the keys themselves are secrets)
+func (p *apiKeyPool) status() []APIKeyStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	statuses := make([]APIKeyStatus, 0, len(p.keys))
+	for i, key := range p.keys {
+		statuses = append(statuses, APIKeyStatus{Index: i, Failures: key.failures, Skipped: now.Before(key.skipUntil)})
+	}
+	return statuses
+}
+
+// isKeyProblem reports whether a WMATA status code is about the key rather than the request,
+// i.e. worth retrying with a different key
+func isKeyProblem(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden
+}
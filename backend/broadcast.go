@@ -0,0 +1,69 @@
+package main
+
+import "sync"
+
+// A small pub/sub broadcaster for prediction refreshes.
+// refreshTrainPredictions publishes every new snapshot; streaming handlers (SSE, WebSocket) subscribe
+// and get it pushed to them, instead of each one polling the cache.
+
+// broadcaster fans out each published value to every subscriber
+type broadcaster[T any] struct {
+	mu          sync.Mutex
+	subscribers map[chan T]struct{} // map used as a set of channels
+}
+
+// predictionUpdates carries every new predictions snapshot (all stations, in WMATA's order)
+var predictionUpdates = newBroadcaster[[]TrainPrediction]()
+
+func newBroadcaster[T any]() *broadcaster[T] {
+	return &broadcaster[T]{subscribers: make(map[chan T]struct{})}
+}
+
+// Subscribe returns a channel that receives every published value. Call Unsubscribe when done.
+// The channel holds one value: a slow subscriber only ever misses intermediate snapshots,
+// it always ends up with the latest one.
+func (b *broadcaster[T]) Subscribe() chan T {
+	ch := make(chan T, 1)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+// Unsubscribe removes a subscriber (its channel is not closed, so a pending read just stays pending)
+func (b *broadcaster[T]) Unsubscribe(ch chan T) {
+	b.mu.Lock()
+	delete(b.subscribers, ch)
+	b.mu.Unlock()
+}
+
+// Publish sends value to every subscriber without ever blocking
+// If a subscriber hasn't read the previous value yet, that stale value is dropped for the new one.
+func (b *broadcaster[T]) Publish(value T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- value:
+			continue
+		default:
+		}
+		// Buffer full: drop the old value (if the subscriber didn't just take it) and send the new one
+		select {
+		case <-ch:
+		default:
+		}
+		select {
+		case ch <- value:
+		default:
+		}
+	}
+}
+
+// Count returns the number of current subscribers
+func (b *broadcaster[T]) Count() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
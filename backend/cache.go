@@ -1,48 +1,262 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"math/rand/v2"
+	"net"
 	"net/http"
+	"net/url"
+	"reflect"
+	"runtime/debug"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"golang.org/x/sync/singleflight"
 )
 
 // Cache for station data (SERVER-SIDE)
 // This cache is shared by ALL users, when one user triggers a cache refresh, everyone benefits.
 // Only fetches from WMATA API once every 24 hours.
 var (
-	cachedStations  []StationInfo     // Cached station data (stored in server memory)
-	cachedEntrances []StationEntrance // Cached entrance data (stored in server memory)
-	cachedLines     []Lines           // Cached rail lines data
-	cachedParking   []StationParking  // Cached parking data
-	cacheTime       time.Time         // When the cache was last updated
-	cacheDuration   = 24 * time.Hour  // Cache for 24 hours (station data rarely changes)
-	cacheMutex      sync.RWMutex      // Protects cache from concurrent HTTP requests
-
-	cachedPredictions       []TrainPrediction
-	predictionCacheTime     time.Time
-	predictionCacheDuration = 25 * time.Second // Cache valid for 25s (refreshed every 20s = 5s buffer)
-	predictionMutex         sync.RWMutex
+	// The static bundle (see staticBundle) under cacheKeyAll, read with staticData
+	staticCache Cache[staticBundle] = newMemoryCache[staticBundle]()
+	cacheMutex  sync.Mutex          // Only keeps static refreshes to one at a time, readers don't need it
+
+	staticRetryWait = 1 * time.Minute // After a failed refetch, keep serving the old data this long before trying again
+
+	wmataRequestTimeout     = 10 * time.Second // Max time for one WMATA call, overridable via WMATA_TIMEOUT
+	stationFetchConcurrency = 5                // Max parallel jStationInfo calls (kept low to stay under WMATA rate limits), overridable via STATION_FETCH_CONCURRENCY
+	stationFetchAttempts    = 3                // Tries per jStationInfo call before giving up on that station
+	stationRetryDelay       = 500 * time.Millisecond
+
+	// How often the background loops refresh each cache (also used by /health to detect stale data)
+	// Overridable via STATIC_REFRESH_INTERVAL / PREDICTION_REFRESH_INTERVAL, see main.go
+	staticRefreshInterval     = 24 * time.Hour
+	predictionRefreshInterval = 20 * time.Second
+	refreshJitter             = 0.1 // Each refresh fires at interval ± 10%, overridable via REFRESH_JITTER (0 disables)
+
+	// The "All" predictions response, under cacheKeyAll. This one and the per-stop / per-station caches below
+	// go through the Cache interface (see cachestore.go), so they could live outside this process.
+	predictionCache Cache[[]TrainPrediction] = newMemoryCache[[]TrainPrediction]()
+
+	predictionCacheBuffer              = 5 * time.Second // Extra validity on top of the refresh interval
+	predictionMaxStale                 = 2 * time.Minute // Past this age, stale predictions aren't served while refreshing
+	predictionRefreshing  atomic.Bool                    // True while an async refresh is running (see refreshTrainPredictionsAsync)
+	predictionMutex       sync.RWMutex                   // Held while refreshing, readers that need a consistent view RLock it
+
+	// Elevator outages and rail incidents, each under cacheKeyAll. The mutexes only keep refreshes to one at a time.
+	outageCache   Cache[[]ElevatorIncident] = newMemoryCache[[]ElevatorIncident]()
+	outageMutex   sync.Mutex
+	incidentCache Cache[[]Incident] = newMemoryCache[[]Incident]()
+	incidentMutex sync.Mutex
+
+	// Paths between stations never change (until a new station opens), but there are thousands of
+	// from/to pairs, so they're kept in a bounded LRU rather than a map that grows forever
+	pathCacheSize = 500                                            // Overridable via PATH_CACHE_SIZE
+	cachedPaths   = newLRUCache[string, []PathItem](pathCacheSize) // Keyed by "FROM|TO" station codes
+
+	// Travel time and fares per from/to pair (/traveltime), same idea as paths: static, but too many pairs to fetch up front
+	cachedTravelTimes = newLRUCache[string, []StationToStation](pathCacheSize) // Keyed by "FROM|TO" station codes
+
+	// Bus predictions are cached per stop, since there are thousands of stops and we only want the requested ones
+	busPredictionCache Cache[BusPredictionsResponse] = newMemoryCache[BusPredictionsResponse]() // Keyed by stop ID
+
+	// Predictions for just a few stations (/nexttrains?codes=), cached per station code,
+	// so single-station pages don't need the giant "All" response
+	stationPredictionCache Cache[[]TrainPrediction] = newMemoryCache[[]TrainPrediction]() // Keyed by station code
+
+	// Entrances near a point, from WMATA's own radius search (/entrances/near), before the full list is cached.
+	// Every point is different, so like paths they go in a bounded LRU. Keyed by rounded lat/lon + radius.
+	cachedNearbyEntrances = newLRUCache[string, nearbyEntrancesCacheEntry](200)
+)
+
+// nearbyEntrancesCacheEntry holds one radius search's entrances and when they were fetched
+type nearbyEntrancesCacheEntry struct {
+	entrances []StationEntrance
+	fetchedAt time.Time
+}
+
+// cacheDurations struct: How long each cached dataset counts as fresh
+// The datasets change at very different rates (parking capacity barely ever, incidents by the minute),
+// so each gets its own duration instead of one constant. Filled from env vars at startup, see main.go.
+type cacheDurations struct {
+	Stations        time.Duration // Station list + jStationInfo details
+	Entrances       time.Duration
+	Lines           time.Duration
+	Parking         time.Duration
+	StationTimes    time.Duration
+	Predictions     time.Duration // Defaults to PREDICTION_REFRESH_INTERVAL + predictionCacheBuffer
+	Outages         time.Duration
+	Incidents       time.Duration
+	BusPredictions  time.Duration // Per stop
+	NearbyEntrances time.Duration // Per radius search, see fetchEntrancesNear
+}
+
+var cacheTTL = cacheDurations{
+	Stations:        24 * time.Hour, // Station data rarely changes
+	Entrances:       24 * time.Hour,
+	Lines:           24 * time.Hour,
+	Parking:         7 * 24 * time.Hour, // Parking capacity barely changes (still refreshed with the daily static refresh)
+	StationTimes:    24 * time.Hour,
+	Predictions:     predictionRefreshInterval + predictionCacheBuffer, // 25s by default (refreshed every 20s = 5s buffer)
+	Outages:         5 * time.Minute,                                   // Outages change through the day, but not every few seconds
+	Incidents:       2 * time.Minute,                                   // Delays come and go quickly, keep this short
+	BusPredictions:  30 * time.Second,
+	NearbyEntrances: 5 * time.Minute,
+}
+
+// staticBundle is everything refreshAllStations caches: the static datasets, the indexes built from them,
+// and when each dataset was fetched. It's stored in staticCache as one value and swapped in whole.
+// A stored bundle is never modified: refreshes copy it, replace fields on the copy (under cacheMutex, so two
+// refreshes can't drop each other's changes) and Set that. Handlers Get a bundle and get a consistent view
+// of all of it, however long they hold on to it. Exported fields, so a shared Cache could JSON-encode it.
+type staticBundle struct {
+	Stations           []StationInfo            // nil until the first successful fetch, see fetchAllStations
+	StationsByLine     map[string][]StationInfo // Stations indexed by line code, see indexStationsByLine
+	Entrances          []StationEntrance
+	EntrancesByStation map[string][]StationEntrance // Entrances indexed by station code, see indexEntrances
+	Lines              []Lines
+	Parking            []StationParking
+	StationTimes       []StationTime // Opening / first & last train times
+
+	ExpectedStations int      // How many stations jStations listed on the last successful fetch
+	MissingStations  []string // Codes from that list with no entry in Stations, see missingStationCodes
+	Checksum         string   // SHA-256 of the datasets, see updateStaticChecksum
+
+	// When each dataset was last fetched, since each one can expire on its own (see fetchStaticDataset).
+	// StationsFetch.FetchedAt is the static cache time shown in X-Cache-Age and /health.
+	StationsFetch     staticDataset
+	EntrancesFetch    staticDataset
+	LinesFetch        staticDataset
+	ParkingFetch      staticDataset
+	StationTimesFetch staticDataset
+}
+
+// staticData returns the current static bundle (a zero bundle, with nil Stations, before anything has loaded)
+func staticData() staticBundle {
+	bundle, _ := staticCache.Get(cacheKeyAll)
+	return bundle
+}
+
+// staticDataset tracks one of the static datasets that can be refetched on its own (see fetchStaticDataset)
+type staticDataset struct {
+	FetchedAt   time.Time // Last successful fetch
+	AttemptedAt time.Time // Last fetch attempt, successful or not (used to back off after failures)
+}
+
+// status reports the dataset for /health
+func (d staticDataset) status() DatasetStatus {
+	return DatasetStatus{
+		LastSuccess: d.FetchedAt,
+		LastAttempt: d.AttemptedAt,
+		Failing:     d.AttemptedAt.After(d.FetchedAt),
+	}
+}
+
+// markFetched records a successful fetch
+func (d *staticDataset) markFetched(at time.Time) {
+	d.FetchedAt = at
+	d.AttemptedAt = at
+}
+
+// Startup warmup state: true while main.go's pre-warm for that cache is still running.
+// While set, a cache miss returns errWarmingUp (handlers answer 503) instead of piling onto the pre-warm fetch.
+var (
+	staticWarming      atomic.Bool
+	predictionsWarming atomic.Bool
+	errWarmingUp       = errors.New("cache is still warming up")
 )
 
+// wmataBaseURL is the host every WMATA endpoint path is appended to (see wmataURL)
+// A package variable rather than a constant so tests can point it at an httptest.Server,
+// and overridable via WMATA_BASE_URL (e.g. a caching proxy or a mock during development).
+var wmataBaseURL = "https://api.wmata.com"
+
+// wmataURL builds a full WMATA URL from an endpoint path like "/Rail.svc/json/jLines"
+func wmataURL(path string) string {
+	return wmataBaseURL + path
+}
+
+// errWMATATimeout is returned (wrapped) when a WMATA call takes longer than wmataRequestTimeout
+var errWMATATimeout = errors.New("WMATA request timed out")
+
+// wmataStatusError is returned when WMATA answers with a non-200 status
+// Callers can pull out the status code with errors.As (e.g. to spot a rejected API key).
+type wmataStatusError struct {
+	StatusCode int
+}
+
+func (e *wmataStatusError) Error() string {
+	return fmt.Sprintf("API returned status %d", e.StatusCode)
+}
+
 // Helper function to fetch from WMATA API
 // Takes a URL and API key, returns the response body as bytes or an error
-func fetchFromWMATA(url string, apiKey string) ([]byte, error) {
+// apiKey can be a comma-separated list of keys: calls rotate through them, and a key that's
+// rate limited or rejected fails over to the next one (see apikeys.go).
+func fetchFromWMATA(ctx context.Context, url string, apiKey string) (body []byte, err error) {
+	if usingFixtures() {
+		return fetchFixture(url) // No WMATA call at all, so no metrics, rate limiting or keys either
+	}
+
+	// Count every call, and (via defer, once we know the outcome) every failure
+	endpoint := wmataEndpointLabel(url)
+	wmataRequestsTotal.WithLabelValues(endpoint).Inc()
+	defer func() {
+		if err != nil {
+			wmataRequestFailuresTotal.WithLabelValues(endpoint).Inc()
+		}
+	}()
+
+	pool := keyPoolFor(apiKey)
+	for attempt := 0; attempt < pool.size(); attempt++ {
+		key := pool.pick()
+		if err = waitForWMATABudget(ctx, endpoint, key.limiter); err != nil { // The key's own budget, so failing over doesn't wait on this one's
+			return nil, err
+		}
+		body, err = fetchWithKey(ctx, url, endpoint, key.value)
+
+		var statusErr *wmataStatusError
+		if errors.As(err, &statusErr) && isKeyProblem(statusErr.StatusCode) {
+			pool.reportFailure(key, statusErr.StatusCode)
+			continue // Fail over to the next key
+		}
+		if err == nil {
+			pool.reportSuccess(key)
+		}
+		return body, err
+	}
+	return nil, err // Every key was rate limited or rejected
+}
+
+// fetchWithKey makes one WMATA call with one key (fetchFromWMATA picks the key)
+func fetchWithKey(ctx context.Context, url string, endpoint string, apiKey string) ([]byte, error) {
+	// The context deadline covers the whole call (connect, headers AND reading the body),
+	// so a hung WMATA connection can't hold a cache's write lock forever.
+	// Cancelling the caller's ctx (e.g. the browser went away) aborts the call too.
+	ctx, cancel := context.WithTimeout(ctx, wmataRequestTimeout)
+	defer cancel()
+
 	// Build a GET request to the WMATA API
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("api_key", apiKey)
 
-	// &http.Client{} means "create a new http.Client and give me a pointer to it"
-	client := &http.Client{}
-	resp, err := client.Do(req) // Send the request
+	callStart := time.Now()
+	resp, err := wmataClient.Do(req) // Send the request (shared client, so connections to WMATA are reused)
 	if err != nil {
-		return nil, err
+		return nil, wrapTimeout(err, endpoint)
 	}
 	// defer = "run this when the function returns" (cleanup); always closes the response body, even if there's an error or early return
 	defer resp.Body.Close()
@@ -50,166 +264,1015 @@ func fetchFromWMATA(url string, apiKey string) ([]byte, error) {
 	// Read the response body (JSON)
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, wrapTimeout(err, endpoint)
 	}
 
+	slog.Debug("WMATA response", "endpoint", endpoint, "status", resp.StatusCode, "bytes", len(body), "duration_ms", time.Since(callStart).Milliseconds())
+
 	// Check if the API returned a success status code (200 OK)
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
+		return nil, &wmataStatusError{StatusCode: resp.StatusCode}
+	}
+	if minBytes, ok := wmataMinResponseBytes[endpoint]; ok && len(body) < minBytes {
+		// Still returned: checkWMATABody / the unmarshal decide if it's usable, this is just an early warning
+		slog.Warn("suspiciously small WMATA response", "endpoint", endpoint, "bytes", len(body), "min_bytes", minBytes)
 	}
 
 	return body, nil
 }
 
+// wmataMinResponseBytes is the smallest normal 200 response per endpoint, about a tenth of a typical one.
+// Anything under it is logged by fetchWithKey, as an early sign of truncated or degraded answers from WMATA.
+// Only endpoints whose answer never legitimately shrinks are listed: predictions are tiny overnight,
+// and a jStationEntrances radius search can match nothing.
+var wmataMinResponseBytes = map[string]int{
+	"/Rail.svc/json/jStations":       5000,
+	"/Rail.svc/json/jStationInfo":    100,
+	"/Rail.svc/json/jLines":          300,
+	"/Rail.svc/json/jStationParking": 1000,
+	"/Rail.svc/json/jStationTimes":   10000,
+}
+
+// errAPIKeyMissing and errAPIKeyRejected are the two ways validateAPIKey can fail fast
+var (
+	errAPIKeyMissing  = errors.New("WMATA_API_KEY is not set (add it to backend/.env)")
+	errAPIKeyRejected = errors.New("WMATA_API_KEY was rejected by WMATA (check the key at https://developer.wmata.com/)")
+)
+
+// validateAPIKey makes one cheap authenticated call (jLines) to check the key before starting up
+// Returns errAPIKeyMissing / errAPIKeyRejected for key problems, or the raw error if WMATA is just unreachable.
+func validateAPIKey(apiKey string) error {
+	if apiKey == "" {
+		return errAPIKeyMissing
+	}
+	_, err := fetchFromWMATA(context.Background(), wmataURL("/Rail.svc/json/jLines"), apiKey)
+	var statusErr *wmataStatusError
+	if errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf("%w (status %d)", errAPIKeyRejected, statusErr.StatusCode)
+	}
+	return err
+}
+
+// wmataClient is the one http.Client every WMATA call goes through. Sharing it (and its Transport) means
+// keep-alive connections are reused instead of paying a new TCP + TLS handshake per call.
+// Rebuilt by main.go when WMATA_TIMEOUT changes the timeout.
+var wmataClient = newWMATAClient(wmataRequestTimeout)
+
+// newWMATAClient builds the shared client. The default Transport only keeps 2 idle connections per host,
+// fewer than the parallel station detail fetches use, so the rest would be closed and redialled every refresh.
+func newWMATAClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone() // Keeps the defaults (proxy from env, dial timeouts, HTTP/2)
+	transport.MaxIdleConnsPerHost = 2 * stationFetchConcurrency
+	transport.IdleConnTimeout = 90 * time.Second
+	return &http.Client{
+		Timeout:       timeout, // Backstop, the per-call context deadline in fetchWithKey normally fires first
+		Transport:     transport,
+		CheckRedirect: wmataCheckRedirect,
+	}
+}
+
+// wmataCheckRedirect only follows redirects that stay on the same host over HTTPS
+// Go copies custom headers like api_key onto redirected requests (it only strips Authorization/Cookie),
+// so following a redirect to another host, or down to plain http, would leak the API key.
+func wmataCheckRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	original := via[0].URL
+	if req.URL.Host != original.Host {
+		return fmt.Errorf("refusing cross-host redirect to %s (would send the API key)", req.URL.Host)
+	}
+	if original.Scheme == "https" && req.URL.Scheme != "https" {
+		return errors.New("refusing redirect from https to http (would send the API key unencrypted)")
+	}
+	return nil
+}
+
+// wrapTimeout turns deadline/timeout errors into errWMATATimeout, so callers can check with errors.Is
+func wrapTimeout(err error, endpoint string) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return fmt.Errorf("%w after %s: %s", errWMATATimeout, wmataRequestTimeout, endpoint)
+	}
+	return err
+}
+
 // Generic fetch and parse - combines fetch + unmarshal
-func fetchAndParse(url string, apiKey string, target interface{}) error {
-	body, err := fetchFromWMATA(url, apiKey)
+// Rejects WMATA's "no data" answers (see checkWMATABody), so they count as a failed fetch and the
+// keep-the-old-cache logic kicks in, instead of unmarshalling into an empty struct that wipes the cache.
+func fetchAndParse(ctx context.Context, url string, apiKey string, target interface{}) error {
+	body, err := fetchFromWMATA(ctx, url, apiKey)
 	if err != nil {
 		return err
 	}
+	if err := checkWMATABody(body); err != nil {
+		return err
+	}
+	if strictJSON {
+		warnOnSchemaDrift(url, body, target)
+	}
 	return json.Unmarshal(body, target)
 }
 
+// Strict JSON mode (WMATA_STRICT_JSON=true, meant for development): every WMATA response is also decoded
+// with DisallowUnknownFields, and a field we don't model gets a warning. Off by default because
+// json.Unmarshal ignoring new fields is exactly what keeps production running when WMATA adds one.
+var strictJSON = false
+
+// warnOnSchemaDrift decodes the body strictly into a throwaway value of target's type and logs what didn't fit
+// Only logs: the response is still parsed leniently by fetchAndParse afterwards.
+func warnOnSchemaDrift(url string, body []byte, target interface{}) {
+	scratch := reflect.New(reflect.TypeOf(target).Elem()).Interface() // Same type as *target, but zeroed
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(scratch); err != nil {
+		slog.Warn("WMATA response doesn't match our types", "endpoint", wmataEndpointLabel(url), "err", err)
+	}
+}
+
+// errWMATANoData is returned (wrapped) when WMATA answers 200 but the body holds no data
+var errWMATANoData = errors.New("WMATA returned no data")
+
+// checkWMATABody spots 200 responses that aren't really data: null, {}, {"Trains": null}, or an error-shaped
+// object like {"Message": "An error has occurred."} / {"statusCode": 500, "message": "..."}.
+// Only the shape is checked. An expected list that's present but empty (e.g. no trains overnight) is a real answer.
+func checkWMATABody(body []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil // Not an object (or not JSON at all), leave it to the real unmarshal to judge
+	}
+
+	var message string
+	for key, value := range fields {
+		switch strings.ToLower(key) {
+		case "message":
+			json.Unmarshal(value, &message) // Best effort, only used in the error text
+		case "statuscode":
+		default:
+			if strings.TrimSpace(string(value)) != "null" {
+				return nil // Has a real data field
+			}
+		}
+	}
+	if message != "" {
+		return fmt.Errorf("%w: %s", errWMATANoData, message)
+	}
+	return errWMATANoData
+}
+
+// refreshGroup coalesces concurrent cache misses: if ten requests miss at once, only the first runs
+// the refresh and the other nine wait for it and share its result, instead of queueing up on the mutex
+// and each replaying the double-check (or worse, each calling WMATA).
+var refreshGroup singleflight.Group
+
+// coalesce runs fn through refreshGroup under key, so only one fn per key is in flight at a time
+// singleflight hands back interface{}, this wrapper turns it back into the real type.
+//
+// Cancellation: the shared fn runs with context.WithoutCancel(ctx), so the client that happened to start it
+// can't abort a refresh the other nine are waiting on (and whose result goes into the cache everyone reads).
+// What a cancelled client DOES stop is its own wait: it returns ctx.Err() straight away and the refresh
+// carries on in the background for everyone else.
+func coalesce[T any](ctx context.Context, key string, fn func(ctx context.Context) (T, error)) (T, error) {
+	detached := context.WithoutCancel(ctx) // Keeps ctx's values, drops its cancellation and deadline
+	results := refreshGroup.DoChan(key, func() (interface{}, error) {
+		return fn(detached)
+	})
+
+	var zero T
+	select {
+	case result := <-results:
+		if result.Err != nil {
+			return zero, result.Err
+		}
+		return result.Val.(T), nil
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// missingStationData returns the station codes the cached list is missing (see refreshStaticCache)
+// and how many stations it should have. No codes means the list is complete.
+func missingStationData() ([]string, int) {
+	bundle := staticData()
+	return slices.Clone(bundle.MissingStations), bundle.ExpectedStations
+}
+
+// staticFetchedAt returns when the static cache (stations, lines, parking, ...) was last filled
+func staticFetchedAt() time.Time {
+	return staticData().StationsFetch.FetchedAt
+}
+
 // Helper function to fetch all stations with caching
 // Returns cached data if it's fresh, otherwise fetches from API
-func fetchAllStations(apiKey string) ([]StationInfo, error) {
-	// Check if cache is still valid (using read lock for concurrent safety)
-	cacheMutex.RLock()
-	if time.Since(cacheTime) < cacheDuration && len(cachedStations) > 0 {
-		defer cacheMutex.RUnlock()
-		return cachedStations, nil
+func fetchAllStations(ctx context.Context, apiKey string) ([]StationInfo, error) {
+	// Check if cache is still valid
+	// Also counts as a hit if a refresh failed a moment ago: the old list is served until staticRetryWait passes,
+	// rather than every request retrying a WMATA that's down.
+	// nil means nothing was ever loaded, while an empty non-nil list means WMATA really answered with no stations
+	// (see refreshStaticCache). That's served as [] rather than an error, and retried after staticRetryWait.
+	bundle := staticData()
+	fresh := time.Since(bundle.StationsFetch.FetchedAt) < cacheTTL.Stations || time.Since(bundle.StationsFetch.AttemptedAt) < staticRetryWait
+	if fresh && bundle.Stations != nil {
+		cacheRequestsTotal.WithLabelValues("static", "hit").Inc()
+		return bundle.Stations, nil
+	}
+	cacheRequestsTotal.WithLabelValues("static", "miss").Inc()
+	if staticWarming.Load() {
+		return nil, errWarmingUp
 	}
-	cacheMutex.RUnlock()
 
-	return refreshAllStations(apiKey)
+	return coalesce(ctx, "static", func(ctx context.Context) ([]StationInfo, error) { return refreshAllStations(ctx, apiKey) })
 }
 
 // refreshAllStations ALWAYS fetches fresh data (used by background refresh)
-func refreshAllStations(apiKey string) ([]StationInfo, error) {
+// Degrades gracefully: if the station list fails (or comes back empty) but we already have one,
+// the old list is kept and the other datasets are still refreshed. Only errors when the fetch itself failed and
+// there's nothing to serve, an empty answer with nothing cached is returned as an empty list.
+func refreshAllStations(ctx context.Context, apiKey string) ([]StationInfo, error) {
+	return refreshStaticCache(ctx, apiKey, false)
+}
+
+// forceRefreshAllStations is refreshAllStations minus the "someone just refreshed" shortcut (/admin/refresh)
+func forceRefreshAllStations(ctx context.Context, apiKey string) ([]StationInfo, error) {
+	return refreshStaticCache(ctx, apiKey, true)
+}
+
+// refreshStaticCache does the work for refreshAllStations / forceRefreshAllStations
+func refreshStaticCache(ctx context.Context, apiKey string, force bool) ([]StationInfo, error) {
 	fetchStart := time.Now()
 
-	// Acquire write lock to update cache
+	// One refresh at a time. Everything below fills in a copy of the current bundle, stored whole at the end,
+	// so handlers keep reading the old one until then.
 	cacheMutex.Lock()
 	defer cacheMutex.Unlock()
+	bundle := staticData()
 
-	// Double-check: someone might have just refreshed
-	if time.Since(cacheTime) < 1*time.Minute && len(cachedStations) > 0 {
-		return cachedStations, nil
+	// Double-check: someone might have just refreshed (or just tried to)
+	if !force && time.Since(bundle.StationsFetch.AttemptedAt) < 1*time.Minute && bundle.Stations != nil {
+		return bundle.Stations, nil
 	}
+	bundle.StationsFetch.AttemptedAt = time.Now()
 
-	// Fetch station list
+	// Fetch station list, then detailed info for each station (in parallel, see fetchStationDetails)
+	var detailedStations []StationInfo
+	var sequentialTime, detailsDuration time.Duration
 	var stationsResp StationsResponse
-	if err := fetchAndParse("https://api.wmata.com/Rail.svc/json/jStations", apiKey, &stationsResp); err != nil {
-		return nil, err
+	stationsErr := fetchAndParse(ctx, wmataURL("/Rail.svc/json/jStations"), apiKey, &stationsResp)
+	if stationsErr == nil {
+		detailsStart := time.Now()
+		detailedStations, sequentialTime = fetchStationDetails(ctx, stationsResp.Stations, apiKey, bundle.Stations)
+		detailsDuration = time.Since(detailsStart)
+		// Every detail fetch failing is WMATA (or the key) having trouble, not an answer, so it's an error even
+		// with nothing cached: handlers then answer 5xx instead of a false []. An empty jStations list is far
+		// more likely a hiccup than every station closing too, so an old list wins over it.
+		if len(detailedStations) == 0 && len(stationsResp.Stations) > 0 {
+			stationsErr = fmt.Errorf("all %d station detail fetches failed", len(stationsResp.Stations))
+		} else if len(detailedStations) == 0 && len(bundle.Stations) > 0 {
+			stationsErr = errors.New("station list came back empty")
+		}
+	}
+	if stationsErr != nil && len(bundle.Stations) == 0 {
+		staticCache.Set(cacheKeyAll, bundle) // Still nothing to serve, only the attempt is recorded (for /health)
+		recordRefreshStats("static", fetchStart, nil, stationsErr)
+		return nil, stationsErr // Nothing old to fall back on
+	}
+
+	// Fetch the other static datasets (a failure only costs that dataset, the old copy is kept)
+	entrancesErr := refreshEntrances(ctx, apiKey, &bundle)
+	if entrancesErr != nil {
+		slog.Error("fetching entrances failed", "err", entrancesErr)
+	}
+	linesErr := refreshLines(ctx, apiKey, &bundle)
+	if linesErr != nil {
+		slog.Error("fetching lines failed", "err", linesErr)
+	}
+	parkingErr := refreshParking(ctx, apiKey, &bundle)
+	if parkingErr != nil {
+		slog.Error("fetching parking failed", "err", parkingErr)
+	}
+	stationTimesErr := refreshStationTimes(ctx, apiKey, &bundle)
+	if stationTimesErr != nil {
+		slog.Error("fetching station times failed", "err", stationTimesErr)
+	}
+
+	// Update cache, or keep the previous station list if this fetch failed
+	if stationsErr != nil {
+		slog.Error("fetching stations failed, keeping the previous station list",
+			"err", stationsErr,
+			"stations", len(bundle.Stations),
+			"age_minutes", int(time.Since(bundle.StationsFetch.FetchedAt).Minutes()),
+		)
+	} else if len(detailedStations) == 0 {
+		// Nothing cached either: serve [] for now, but leave FetchedAt alone so it's retried after staticRetryWait
+		// instead of being trusted for the whole cacheTTL.Stations
+		slog.Warn("station list came back empty, serving an empty list until the next attempt")
+		bundle.Stations = []StationInfo{} // Non-nil, see fetchAllStations
+		bundle.StationsByLine = indexStationsByLine(bundle.Stations)
+	} else {
+		normalizeStationTogether(detailedStations)
+		bundle.Stations = detailedStations
+		bundle.StationsByLine = indexStationsByLine(bundle.Stations)
+		bundle.StationsFetch.FetchedAt = time.Now()
+	}
+	if stationsErr == nil {
+		// Stations whose details failed with no old copy to fall back on are simply not in the list,
+		// so /stations flags it with X-Partial-Data and /health lists their codes
+		bundle.ExpectedStations = len(stationsResp.Stations)
+		bundle.MissingStations = missingStationCodes(stationsResp.Stations, detailedStations)
+		if len(bundle.MissingStations) > 0 {
+			slog.Warn("station list is incomplete", "expected", bundle.ExpectedStations, "missing", bundle.MissingStations)
+		}
+	}
+
+	fetchDuration := time.Since(fetchStart)
+	refreshDurationSeconds.WithLabelValues("static").Observe(fetchDuration.Seconds())
+	// Speedup = how long the detail calls would have taken back-to-back vs how long they actually took
+	speedup := 0.0
+	if detailsDuration > 0 {
+		speedup = float64(sequentialTime) / float64(detailsDuration)
+	}
+	slog.Debug("[Static] API calls",
+		"duration_ms", fetchDuration.Milliseconds(),
+		"station_details_ms", detailsDuration.Milliseconds(),
+		"speedup_vs_sequential", speedup,
+		"stations", len(bundle.Stations),
+		"entrances", len(bundle.Entrances),
+		"lines", len(bundle.Lines),
+		"parking", len(bundle.Parking),
+		"station_times", len(bundle.StationTimes),
+	)
+	recordRefreshStats("static", fetchStart, map[string]int{
+		"stations":     len(bundle.Stations),
+		"entrances":    len(bundle.Entrances),
+		"lines":        len(bundle.Lines),
+		"parking":      len(bundle.Parking),
+		"stationTimes": len(bundle.StationTimes),
+	}, stationsErr, entrancesErr, linesErr, parkingErr, stationTimesErr)
+
+	updateStaticChecksum(&bundle)
+	staticCache.Set(cacheKeyAll, bundle)
+
+	// Persist for faster cold starts (a failure here only costs us the next restart's head start)
+	// An empty list isn't worth persisting, loadStaticCache would refuse it anyway
+	if len(bundle.Stations) == 0 {
+		return bundle.Stations, nil
+	}
+	if err := saveStaticCache(bundle); err != nil {
+		slog.Error("saving static cache to disk failed", "file", staticCacheFile, "err", err)
+	}
+
+	return bundle.Stations, nil
+}
+
+// refreshEntrances fetches jStationEntrances into bundle (a copy that the caller stores, see staticBundle)
+func refreshEntrances(ctx context.Context, apiKey string, bundle *staticBundle) error {
+	bundle.EntrancesFetch.AttemptedAt = time.Now()
+	var resp EntrancesResponse
+	if err := fetchAndParse(ctx, wmataURL("/Rail.svc/json/jStationEntrances"), apiKey, &resp); err != nil {
+		return err
+	}
+	bundle.Entrances = resp.Entrances
+	bundle.EntrancesByStation = indexEntrances(bundle.Entrances)
+	bundle.EntrancesFetch.markFetched(time.Now())
+	return nil
+}
+
+// refreshLines fetches jLines into bundle
+func refreshLines(ctx context.Context, apiKey string, bundle *staticBundle) error {
+	bundle.LinesFetch.AttemptedAt = time.Now()
+	var resp LinesResponse
+	if err := fetchAndParse(ctx, wmataURL("/Rail.svc/json/jLines"), apiKey, &resp); err != nil {
+		return err
+	}
+	bundle.Lines = resp.Lines
+	bundle.LinesFetch.markFetched(time.Now())
+	return nil
+}
+
+// refreshParking fetches jStationParking into bundle
+func refreshParking(ctx context.Context, apiKey string, bundle *staticBundle) error {
+	bundle.ParkingFetch.AttemptedAt = time.Now()
+	var resp StationsParkingResponse
+	if err := fetchAndParse(ctx, wmataURL("/Rail.svc/json/jStationParking"), apiKey, &resp); err != nil {
+		return err
+	}
+	bundle.Parking = resp.StationsParking
+	bundle.ParkingFetch.markFetched(time.Now())
+	return nil
+}
+
+// refreshStationTimes fetches jStationTimes into bundle
+// One call returns every station when no StationCode is given.
+func refreshStationTimes(ctx context.Context, apiKey string, bundle *staticBundle) error {
+	bundle.StationTimesFetch.AttemptedAt = time.Now()
+	var resp StationTimesResponse
+	if err := fetchAndParse(ctx, wmataURL("/Rail.svc/json/jStationTimes"), apiKey, &resp); err != nil {
+		return err
+	}
+	bundle.StationTimes = resp.StationTimes
+	bundle.StationTimesFetch.markFetched(time.Now())
+	return nil
+}
+
+// fetchStaticDataset returns one of the static datasets below, refetching just that dataset once it's
+// older than its own cache duration. The first load still comes from refreshAllStations (via fetchAllStations).
+// If the refetch fails the old data keeps being served, and it isn't retried until staticRetryWait has passed.
+// Cold or expired, a burst of requests shares one fetch: the station list through fetchAllStations' coalesce,
+// and the dataset's own refetch through coalesce under "static:<name>".
+// dataset picks the dataset's fetch times out of a bundle, get picks the data itself.
+func fetchStaticDataset[T any](ctx context.Context, apiKey string, name string, dataset func(staticBundle) staticDataset, ttl time.Duration, refresh func(ctx context.Context, apiKey string, bundle *staticBundle) error, get func(staticBundle) T) (T, error) {
+	if _, err := fetchAllStations(ctx, apiKey); err != nil {
+		var zero T
+		return zero, err
 	}
 
-	// Fetch detailed info for each station (sequentially)
+	needsRefresh := func(bundle staticBundle) bool {
+		fetch := dataset(bundle)
+		return time.Since(fetch.FetchedAt) >= ttl && time.Since(fetch.AttemptedAt) >= staticRetryWait
+	}
+
+	if bundle := staticData(); !needsRefresh(bundle) {
+		return get(bundle), nil
+	}
+
+	return coalesce(ctx, "static:"+name, func(ctx context.Context) (T, error) {
+		cacheMutex.Lock()
+		defer cacheMutex.Unlock()
+		bundle := staticData()    // Re-read under the lock, a full refresh may have just stored a newer one
+		if needsRefresh(bundle) { // Double-check: someone might have just refetched (or just failed to)
+			fetchStart := time.Now()
+			err := refresh(ctx, apiKey, &bundle)
+			if err != nil {
+				slog.Error("refetching static data failed, serving the old copy", "dataset", name, "err", err)
+			} else {
+				slog.Debug("[Static] API call", "dataset", name, "duration_ms", time.Since(fetchStart).Milliseconds())
+				updateStaticChecksum(&bundle)
+			}
+			staticCache.Set(cacheKeyAll, bundle) // Stored on failure too, so the attempt time holds off retries
+			recordRefreshStats(name, fetchStart, nil, err)
+		}
+		return get(bundle), nil
+	})
+}
+
+// fetchEntrances returns the cached entrances (refetched after cacheTTL.Entrances)
+// Use staticData().EntrancesByStation after calling this for per-station lookups.
+func fetchEntrances(ctx context.Context, apiKey string) ([]StationEntrance, error) {
+	return fetchStaticDataset(ctx, apiKey, "entrances",
+		func(b staticBundle) staticDataset { return b.EntrancesFetch }, cacheTTL.Entrances, refreshEntrances,
+		func(b staticBundle) []StationEntrance { return b.Entrances })
+}
+
+// fetchLines returns the cached lines (refetched after cacheTTL.Lines)
+func fetchLines(ctx context.Context, apiKey string) ([]Lines, error) {
+	return fetchStaticDataset(ctx, apiKey, "lines",
+		func(b staticBundle) staticDataset { return b.LinesFetch }, cacheTTL.Lines, refreshLines,
+		func(b staticBundle) []Lines { return b.Lines })
+}
+
+// fetchParking returns the cached parking info (refetched after cacheTTL.Parking)
+func fetchParking(ctx context.Context, apiKey string) ([]StationParking, error) {
+	return fetchStaticDataset(ctx, apiKey, "parking",
+		func(b staticBundle) staticDataset { return b.ParkingFetch }, cacheTTL.Parking, refreshParking,
+		func(b staticBundle) []StationParking { return b.Parking })
+}
+
+// fetchStationTimes returns the cached station times (refetched after cacheTTL.StationTimes)
+func fetchStationTimes(ctx context.Context, apiKey string) ([]StationTime, error) {
+	return fetchStaticDataset(ctx, apiKey, "station_times",
+		func(b staticBundle) staticDataset { return b.StationTimesFetch }, cacheTTL.StationTimes, refreshStationTimes,
+		func(b staticBundle) []StationTime { return b.StationTimes })
+}
+
+// fetchStationDetails fetches jStationInfo for every station using a bounded worker pool
+// Returns the stations in the same order as the input list (so /stations output doesn't shuffle),
+// plus the summed duration of every individual call (what a sequential loop would have cost).
+// Each failed call is retried (see fetchStationInfo). A station that still fails keeps its entry from previous
+// (the current cache) if it has one, so a blip doesn't make it vanish from the map until the next refresh.
+// Only a station that fails and was never cached is skipped.
+func fetchStationDetails(ctx context.Context, stations []Station, apiKey string, previous []StationInfo) ([]StationInfo, time.Duration) {
+	// One slot per station: each worker writes only to its own index, so no mutex is needed for results
+	results := make([]*StationInfo, len(stations))
+	callTimes := make([]time.Duration, len(stations))
+
+	// Buffered channel used as a queue of station indexes for the workers to pick up
+	jobs := make(chan int, len(stations))
+	for i := range stations {
+		jobs <- i
+	}
+	close(jobs)
+
+	workers := stationFetchConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	// WaitGroup = "wait until all these goroutines are done" (like joining threads in Rust)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				code := stations[i].Code
+				callStart := time.Now()
+				stationInfo, err := fetchStationInfo(ctx, apiKey, code)
+				callTimes[i] = time.Since(callStart)
+				if err != nil {
+					if old, ok := findStation(previous, code); ok {
+						slog.Warn("fetching station failed, keeping the cached entry", "station", code, "err", err)
+						results[i] = &old
+						continue
+					}
+					slog.Error("fetching station failed", "station", code, "err", err)
+					continue
+				}
+				results[i] = &stationInfo
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Collect successful results in their original order
 	var detailedStations []StationInfo
-	for _, station := range stationsResp.Stations {
-		url := fmt.Sprintf("https://api.wmata.com/Rail.svc/json/jStationInfo?StationCode=%s", station.Code)
-		var stationInfo StationInfo
-		if err := fetchAndParse(url, apiKey, &stationInfo); err != nil {
-			log.Printf("ERROR fetching station %s: %v\n", station.Code, err)
-			continue
+	var sequentialTime time.Duration
+	for i, result := range results {
+		sequentialTime += callTimes[i]
+		if result != nil {
+			detailedStations = append(detailedStations, *result)
 		}
-		detailedStations = append(detailedStations, stationInfo)
 	}
+	return detailedStations, sequentialTime
+}
 
-	// Fetch station entrances
-	var entrancesResp EntrancesResponse
-	if err := fetchAndParse("https://api.wmata.com/Rail.svc/json/jStationEntrances", apiKey, &entrancesResp); err != nil {
-		log.Printf("ERROR fetching entrances: %v\n", err)
-	} else {
-		cachedEntrances = entrancesResp.Entrances
+// missingStationCodes returns the codes in the jStations list that have no detailed entry
+// Stations kept from the previous cache by fetchStationDetails count as present.
+func missingStationCodes(stations []Station, detailed []StationInfo) []string {
+	have := make(map[string]bool, len(detailed))
+	for _, station := range detailed {
+		have[station.Code] = true
 	}
+	missing := []string{} // Non-nil so /health shows [] rather than null
+	for _, station := range stations {
+		if !have[station.Code] {
+			missing = append(missing, station.Code)
+		}
+	}
+	return missing
+}
 
-	// Fetch lines
-	var linesResp LinesResponse
-	if err := fetchAndParse("https://api.wmata.com/Rail.svc/json/jLines", apiKey, &linesResp); err != nil {
-		log.Printf("ERROR fetching lines: %v\n", err)
-	} else {
-		cachedLines = linesResp.Lines
+// fetchStationInfo fetches jStationInfo for one station, retrying up to stationFetchAttempts times in total
+// Waits a little longer before each retry (0.5s, then 1s), which is usually enough for a WMATA hiccup or a 429 to pass.
+func fetchStationInfo(ctx context.Context, apiKey string, code string) (StationInfo, error) {
+	requestURL := wmataURL("/Rail.svc/json/jStationInfo?StationCode=" + url.QueryEscape(code))
+	var err error
+	for attempt := 1; attempt <= stationFetchAttempts; attempt++ {
+		var stationInfo StationInfo
+		if err = fetchAndParse(ctx, requestURL, apiKey, &stationInfo); err == nil {
+			return stationInfo, nil
+		}
+		if attempt == stationFetchAttempts {
+			break
+		}
+		slog.Debug("retrying station fetch", "station", code, "attempt", attempt, "err", err)
+		select {
+		case <-time.After(time.Duration(attempt) * stationRetryDelay):
+		case <-ctx.Done():
+			return StationInfo{}, err // Shutting down (or the caller gave up), don't keep retrying
+		}
 	}
+	return StationInfo{}, err
+}
 
-	// Fetch parking
-	var parkingResp StationsParkingResponse
-	if err := fetchAndParse("https://api.wmata.com/Rail.svc/json/jStationParking", apiKey, &parkingResp); err != nil {
-		log.Printf("ERROR fetching parking: %v\n", err)
-	} else {
-		cachedParking = parkingResp.StationsParking
+// indexStationsByLine groups stations by line code, so "every Orange Line station" is one map lookup
+// A station appears under each of its (up to four) LineCode1-4 values.
+func indexStationsByLine(stations []StationInfo) map[string][]StationInfo {
+	index := make(map[string][]StationInfo)
+	for _, station := range stations {
+		for _, code := range stationLines(station) {
+			index[code] = append(index[code], station)
+		}
 	}
+	return index
+}
 
-	// Update cache
-	cachedStations = detailedStations
-	cacheTime = time.Now()
+// stationNamesByCode snapshots station code -> name from the station cache (empty until stations have loaded)
+func stationNamesByCode() map[string]string {
+	stations := staticData().Stations
+	names := make(map[string]string, len(stations))
+	for _, station := range stations {
+		names[station.Code] = station.Name
+	}
+	return names
+}
 
-	fetchDuration := time.Since(fetchStart)
-	log.Printf("[Static] API calls: %dms, %d stations, %d entrances, %d lines, %d parking\n",
-		fetchDuration.Milliseconds(), len(detailedStations), len(cachedEntrances), len(cachedLines), len(cachedParking))
+// indexEntrances groups entrances by station code, so /entrances is one map lookup instead of a full scan
+// Entrances shared by two station codes (transfer stations) appear under both.
+func indexEntrances(entrances []StationEntrance) map[string][]StationEntrance {
+	index := make(map[string][]StationEntrance)
+	for _, entrance := range entrances {
+		if entrance.StationCode1 != "" {
+			index[entrance.StationCode1] = append(index[entrance.StationCode1], entrance)
+		}
+		if entrance.StationCode2 != "" && entrance.StationCode2 != entrance.StationCode1 {
+			index[entrance.StationCode2] = append(index[entrance.StationCode2], entrance)
+		}
+	}
+	return index
+}
 
-	return detailedStations, nil
+// predictionsFetchedAt returns when the predictions cache was last filled
+func predictionsFetchedAt() time.Time {
+	return cacheFetchedAt(predictionCache, cacheKeyAll)
 }
 
 // Fetch train predictions with caching (20 second refresh)
-func fetchTrainPredictions(apiKey string) ([]TrainPrediction, error) {
-	predictionMutex.RLock()
-	if time.Since(predictionCacheTime) < predictionCacheDuration && len(cachedPredictions) > 0 {
-		defer predictionMutex.RUnlock()
-		return cachedPredictions, nil
+// Stale-while-revalidate: once the cache expires, requests keep getting the old predictions
+// (up to predictionMaxStale) while a single background refresh fetches new ones,
+// so a user request never waits on WMATA unless the data is really old.
+func fetchTrainPredictions(ctx context.Context, apiKey string) ([]TrainPrediction, error) {
+	if predictions, ok := getFresh(predictionCache, cacheKeyAll, cacheTTL.Predictions); ok && len(predictions) > 0 {
+		cacheRequestsTotal.WithLabelValues("predictions", "hit").Inc()
+		return predictions, nil
+	}
+	if predictions, ok := getFresh(predictionCache, cacheKeyAll, predictionMaxStale); ok && len(predictions) > 0 {
+		cacheRequestsTotal.WithLabelValues("predictions", "stale").Inc()
+		refreshTrainPredictionsAsync(apiKey)
+		return predictions, nil
+	}
+	cacheRequestsTotal.WithLabelValues("predictions", "miss").Inc()
+	if predictionsWarming.Load() {
+		return nil, errWarmingUp
 	}
-	predictionMutex.RUnlock()
 
-	return refreshTrainPredictions(apiKey)
+	return coalesce(ctx, "predictions", func(ctx context.Context) ([]TrainPrediction, error) {
+		return refreshTrainPredictions(ctx, apiKey)
+	})
+}
+
+// refreshTrainPredictionsAsync starts a background refresh, unless one is already running
+func refreshTrainPredictionsAsync(apiKey string) {
+	// CompareAndSwap flips false -> true atomically, so only the first caller gets to start a refresh
+	if !predictionRefreshing.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer predictionRefreshing.Store(false)
+		if _, err := refreshTrainPredictions(context.Background(), apiKey); err != nil {
+			slog.Error("background prediction refresh failed", "err", err)
+		}
+	}()
 }
 
 // refreshTrainPredictions always fetches fresh data (used by background refresh)
-func refreshTrainPredictions(apiKey string) ([]TrainPrediction, error) {
+func refreshTrainPredictions(ctx context.Context, apiKey string) ([]TrainPrediction, error) {
+	names := stationNamesByCode()
 	predictionMutex.Lock()
 	defer predictionMutex.Unlock()
 
 	// Double-check pattern (someone might have just refreshed)
-	if time.Since(predictionCacheTime) < 1*time.Second && len(cachedPredictions) > 0 {
-		return cachedPredictions, nil
+	if predictions, ok := getFresh(predictionCache, cacheKeyAll, 1*time.Second); ok && len(predictions) > 0 {
+		return predictions, nil
 	}
 
 	// Fetch fresh predictions
 	fetchStart := time.Now()
-	url := "http://api.wmata.com/StationPrediction.svc/json/GetPrediction/All"
-	body, err := fetchFromWMATA(url, apiKey)
-	if err != nil {
+	var resp TrainPredictionsResponse
+	if err := fetchAndParse(ctx, wmataURL("/StationPrediction.svc/json/GetPrediction/All"), apiKey, &resp); err != nil {
+		recordRefreshStats("predictions", fetchStart, nil, err)
 		return nil, err
 	}
 	fetchDuration := time.Since(fetchStart)
+	refreshDurationSeconds.WithLabelValues("predictions").Observe(fetchDuration.Seconds())
 
-	var resp struct {
-		Trains []TrainPrediction `json:"Trains"`
+	// Parse Min (and tidy up the station names) once here instead of in every client
+	for i := range resp.Trains {
+		enrichPrediction(&resp.Trains[i])
+		resolvePredictionNames(&resp.Trains[i], names)
+	}
+	if n := countSuspect(resp.Trains); n > 0 {
+		slog.Warn("predictions with implausible Min values", "count", n, "max_minutes", predictionMaxMinutes)
 	}
 
-	if err := json.Unmarshal(body, &resp); err != nil {
+	predictionCache.Set(cacheKeyAll, resp.Trains)
+	cachedPredictionsGauge.Set(float64(len(resp.Trains)))
+	predictionUpdates.Publish(resp.Trains) // Push to SSE/WebSocket clients, never blocks
+	recordPredictionSnapshot(time.Now(), resp.Trains)
+
+	slog.Debug("[Predictions] API call", "duration_ms", fetchDuration.Milliseconds(), "trains", len(resp.Trains))
+	recordRefreshStats("predictions", fetchStart, map[string]int{"trains": len(resp.Trains), "suspect": countSuspect(resp.Trains)})
+
+	return resp.Trains, nil
+}
+
+// Fetch elevator/escalator outages with caching (5 minute refresh)
+func fetchOutages(ctx context.Context, apiKey string) ([]ElevatorIncident, error) {
+	return fetchCachedList(ctx, "outages", "units_out", outageCache, &outageMutex, cacheTTL.Outages,
+		func(ctx context.Context) ([]ElevatorIncident, error) {
+			var outagesResp ElevatorIncidentsResponse
+			err := fetchAndParse(ctx, wmataURL("/Incidents.svc/json/ElevatorIncidents"), apiKey, &outagesResp)
+			return outagesResp.ElevatorIncidents, err
+		})
+}
+
+// fetchCachedList returns the list cached under cacheKeyAll in c, refetching it with fetch once it's older than ttl
+// mu keeps refetches to one at a time. Like predictions and the static data, a failed refetch serves the previous
+// list (however old, X-Cache-Age shows it) rather than turning a WMATA blip into 500s. Only with nothing cached
+// is it an error. name is the dataset in /stats, itemsName the count it reports there.
+func fetchCachedList[T any](ctx context.Context, name string, itemsName string, c Cache[[]T], mu *sync.Mutex, ttl time.Duration, fetch func(ctx context.Context) ([]T, error)) ([]T, error) {
+	// No len() check here: an empty list is a valid answer (every unit in service, no incidents)
+	if list, ok := getFresh(c, cacheKeyAll, ttl); ok {
+		return list, nil
+	}
+	ctx = context.WithoutCancel(ctx) // Detached: other requests wait on this refresh too, see coalesce
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Double-check pattern (someone might have just refreshed)
+	if list, ok := getFresh(c, cacheKeyAll, 1*time.Second); ok {
+		return list, nil
+	}
+
+	fetchStart := time.Now()
+	list, err := fetch(ctx)
+	if err != nil {
+		recordRefreshStats(name, fetchStart, nil, err)
+		if previous, ok := c.Get(cacheKeyAll); ok {
+			age, _ := c.Age(cacheKeyAll)
+			slog.Warn("refreshing failed, serving the previous copy", "dataset", name, "age_seconds", int(age.Seconds()), "err", err)
+			return previous, nil
+		}
 		return nil, err
 	}
+	c.Set(cacheKeyAll, list)
 
-	cachedPredictions = resp.Trains
-	predictionCacheTime = time.Now()
+	slog.Debug("API call", "dataset", name, "duration_ms", time.Since(fetchStart).Milliseconds(), itemsName, len(list))
+	recordRefreshStats(name, fetchStart, map[string]int{itemsName: len(list)})
+	return list, nil
+}
+
+// Fetch rail incidents with caching (2 minute refresh)
+func fetchIncidents(ctx context.Context, apiKey string) ([]Incident, error) {
+	return fetchCachedList(ctx, "incidents", "incidents", incidentCache, &incidentMutex, cacheTTL.Incidents,
+		func(ctx context.Context) ([]Incident, error) {
+			var incidentsResp IncidentsResponse
+			err := fetchAndParse(ctx, wmataURL("/Incidents.svc/json/Incidents"), apiKey, &incidentsResp)
+			return incidentsResp.Incidents, err
+		})
+}
 
-	log.Printf("[Predictions] API call: %dms, %d trains\n", fetchDuration.Milliseconds(), len(resp.Trains))
+// Fetch the ordered stations between two stations (jPath), cached per from/to pair
+func fetchPath(ctx context.Context, apiKey string, fromCode string, toCode string) ([]PathItem, error) {
+	key := fromCode + "|" + toCode
 
-	return cachedPredictions, nil
+	if path, ok := cachedPaths.Get(key); ok {
+		return path, nil
+	}
+
+	// Fetch without holding the lock, so a slow call doesn't block lookups for other pairs.
+	// Two requests for the same new pair might both fetch, which is harmless (same result).
+	requestURL := wmataURL(fmt.Sprintf("/Rail.svc/json/jPath?FromStationCode=%s&ToStationCode=%s", url.QueryEscape(fromCode), url.QueryEscape(toCode)))
+	var pathResp PathResponse
+	if err := fetchAndParse(ctx, requestURL, apiKey, &pathResp); err != nil {
+		return nil, err
+	}
+
+	cachedPaths.Add(key, pathResp.Path)
+
+	return pathResp.Path, nil
+}
+
+// Fetch the travel time and fares between two stations (jSrcStationToDstStationInfo), cached per from/to pair
+// Returns an empty slice if WMATA has nothing for the pair.
+func fetchTravelTime(ctx context.Context, apiKey string, fromCode string, toCode string) ([]StationToStation, error) {
+	key := fromCode + "|" + toCode
+
+	if infos, ok := cachedTravelTimes.Get(key); ok {
+		return infos, nil
+	}
+
+	// Fetch without holding a lock (same reasoning as fetchPath)
+	requestURL := wmataURL(fmt.Sprintf("/Rail.svc/json/jSrcStationToDstStationInfo?FromStationCode=%s&ToStationCode=%s", url.QueryEscape(fromCode), url.QueryEscape(toCode)))
+	var resp StationToStationResponse
+	if err := fetchAndParse(ctx, requestURL, apiKey, &resp); err != nil {
+		return nil, err
+	}
+
+	cachedTravelTimes.Add(key, resp.StationToStationInfos)
+
+	return resp.StationToStationInfos, nil
+}
+
+// refreshStationPredictions fetches predictions for the given (validated) station codes in one call,
+// replacing their entries in stationPredictionCache. Used by fetchPredictionsForStations for cache misses,
+// and by the background loop under the "active" prediction strategy (see refreshPredictionsByStrategy).
+func refreshStationPredictions(ctx context.Context, apiKey string, codes []string) error {
+	// Fetch without holding the lock (same reasoning as fetchPath)
+	escaped := make([]string, len(codes))
+	for i, code := range codes {
+		escaped[i] = url.PathEscape(code) // Escaped one by one, PathEscape would turn the commas into %2C
+	}
+	fetchStart := time.Now()
+	var resp TrainPredictionsResponse
+	if err := fetchAndParse(ctx, wmataURL("/StationPrediction.svc/json/GetPrediction/"+strings.Join(escaped, ",")), apiKey, &resp); err != nil {
+		recordRefreshStats("station_predictions", fetchStart, nil, err)
+		return err
+	}
+
+	names := stationNamesByCode()
+	byCode := make(map[string][]TrainPrediction, len(codes))
+	for i := range resp.Trains {
+		enrichPrediction(&resp.Trains[i])
+		resolvePredictionNames(&resp.Trains[i], names)
+		byCode[resp.Trains[i].LocationCode] = append(byCode[resp.Trains[i].LocationCode], resp.Trains[i])
+	}
+	if n := countSuspect(resp.Trains); n > 0 {
+		slog.Warn("predictions with implausible Min values", "count", n, "max_minutes", predictionMaxMinutes)
+	}
+
+	for _, code := range codes {
+		// A station with no trains right now still gets an (empty) entry, so it isn't refetched every request
+		stationPredictionCache.Set(code, byCode[code])
+	}
+
+	slog.Debug("[Predictions] API call", "duration_ms", time.Since(fetchStart).Milliseconds(), "stations", len(codes), "trains", len(resp.Trains))
+	recordRefreshStats("station_predictions", fetchStart, map[string]int{"stations": len(codes), "trains": len(resp.Trains)})
+	return nil
+}
+
+// fetchPredictionsForStations returns predictions for just the given station codes, in the order given
+// Codes that aren't cached (or have expired) are fetched in ONE call: GetPrediction accepts a
+// comma-separated list of codes in place of "All". Each code is then cached on its own, so a later
+// request for an overlapping set only fetches the codes it doesn't already have.
+// The codes should already be validated (they go into the URL path).
+func fetchPredictionsForStations(ctx context.Context, apiKey string, codes []string) ([]TrainPrediction, error) {
+	var missing []string
+	seen := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+		if age, ok := stationPredictionCache.Age(code); !ok || age >= cacheTTL.Predictions {
+			missing = append(missing, code)
+		}
+	}
+
+	if len(missing) == 0 {
+		cacheRequestsTotal.WithLabelValues("station_predictions", "hit").Inc()
+	} else {
+		cacheRequestsTotal.WithLabelValues("station_predictions", "miss").Inc()
+		if err := refreshStationPredictions(ctx, apiKey, missing); err != nil {
+			return nil, err
+		}
+	}
+
+	predictions := []TrainPrediction{} // Non-nil so an empty result encodes as [] instead of null
+	for _, code := range codes {
+		if !seen[code] {
+			continue
+		}
+		seen[code] = false // Only add each station once
+		trains, _ := stationPredictionCache.Get(code)
+		predictions = append(predictions, trains...)
+	}
+	return predictions, nil
+}
+
+// stationPredictionsFetchedAt returns when the oldest of these stations' cached predictions was fetched (for X-Cache-Age)
+func stationPredictionsFetchedAt(codes []string) time.Time {
+	var oldest time.Time
+	for _, code := range codes {
+		if fetchedAt := cacheFetchedAt(stationPredictionCache, code); !fetchedAt.IsZero() && (oldest.IsZero() || fetchedAt.Before(oldest)) {
+			oldest = fetchedAt
+		}
+	}
+	return oldest
+}
+
+// Fetch bus predictions for one stop with caching (30 second refresh, per stop)
+func fetchBusPredictions(ctx context.Context, apiKey string, stopID string) (BusPredictionsResponse, error) {
+	if cached, ok := getFresh(busPredictionCache, stopID, cacheTTL.BusPredictions); ok {
+		return cached, nil
+	}
+
+	// Fetch without holding the lock (same reasoning as fetchPath)
+	requestURL := wmataURL("/NextBusService.svc/json/jPredictions?StopID=" + url.QueryEscape(stopID))
+	var busResp BusPredictionsResponse
+	if err := fetchAndParse(ctx, requestURL, apiKey, &busResp); err != nil {
+		return BusPredictionsResponse{}, err
+	}
+
+	busPredictionCache.Set(stopID, busResp)
+
+	return busResp, nil
+}
+
+// fetchEntrancesNear returns the entrances within radiusMeters of the point (/entrances/near)
+// If the full entrance list is already cached, it's filtered locally. Otherwise WMATA's jStationEntrances
+// does the search (it takes Lat/Lon/Radius), which is much smaller than fetching every entrance.
+// Those results are cached briefly, keyed by the point rounded to 3 decimal places (~100m),
+// so a user nudging the map around doesn't trigger a WMATA call per pixel.
+func fetchEntrancesNear(ctx context.Context, apiKey string, lat, lon, radiusMeters float64) ([]StationEntrance, error) {
+	if all := staticData().Entrances; len(all) > 0 {
+		cacheRequestsTotal.WithLabelValues("nearby_entrances", "hit").Inc()
+		within := []StationEntrance{}
+		for _, entrance := range all {
+			if haversineMeters(lat, lon, entrance.Lat, entrance.Lon) <= radiusMeters {
+				within = append(within, entrance)
+			}
+		}
+		return within, nil
+	}
+
+	key := fmt.Sprintf("%.3f,%.3f,%.0f", lat, lon, radiusMeters)
+	if entry, ok := cachedNearbyEntrances.Get(key); ok && time.Since(entry.fetchedAt) < cacheTTL.NearbyEntrances {
+		cacheRequestsTotal.WithLabelValues("nearby_entrances", "hit").Inc()
+		return entry.entrances, nil
+	}
+	cacheRequestsTotal.WithLabelValues("nearby_entrances", "miss").Inc()
+
+	// Fetch without holding a lock (same reasoning as fetchPath)
+	requestURL := wmataURL(fmt.Sprintf("/Rail.svc/json/jStationEntrances?Lat=%f&Lon=%f&Radius=%.0f", lat, lon, radiusMeters))
+	var resp EntrancesResponse
+	if err := fetchAndParse(ctx, requestURL, apiKey, &resp); err != nil {
+		return nil, err
+	}
+
+	cachedNearbyEntrances.Add(key, nearbyEntrancesCacheEntry{entrances: resp.Entrances, fetchedAt: time.Now()})
+	return resp.Entrances, nil
 }
 
 // startBackgroundRefresh starts a background loop to refresh data at specified intervals
+// The first refresh happens after one interval: main.go already loads the initial data
+// (pre-warm or disk cache), and if that failed the fetch* helpers fetch on the next request anyway.
+// Each wait is interval ± refreshJitter (a fraction), so several instances don't all hit WMATA at the same moment.
 func startBackgroundRefresh(name string, interval time.Duration, refreshFunc func() error) {
-	// Run immediately on startup
-	if err := refreshFunc(); err != nil {
-		log.Printf("ERROR: %s initial refresh failed: %v\n", name, err)
+	// Each loop gets its own random source, seeded from the clock and the loop name,
+	// so the Predictions and Static loops (and separate instances) drift apart instead of lining up
+	seed := uint64(time.Now().UnixNano())
+	for _, c := range name {
+		seed = seed*31 + uint64(c)
 	}
+	rng := rand.New(rand.NewPCG(seed, uint64(interval)))
 
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+	for {
+		time.Sleep(jitteredInterval(interval, refreshJitter, rng))
+		err := runRefresh(name, refreshFunc)
+		if err != nil {
+			slog.Error("refresh failed", "cache", name, "err", err)
+		}
+		recordRefreshResult(name, err)
+	}
+}
 
-	for range ticker.C {
-		if err := refreshFunc(); err != nil {
-			log.Printf("ERROR: %s refresh failed: %v\n", name, err)
+var (
+	refreshLoopFailures = make(map[string]int) // Loop name -> consecutive failed runs, panics included (/health)
+	refreshLoopMutex    sync.Mutex
+)
+
+// runRefresh calls refreshFunc, turning a panic into an error
+// A panic (say a parsing bug meeting malformed data) would otherwise end the loop's goroutine,
+// and the cache would silently never refresh again. The next tick simply tries again.
+func runRefresh(name string, refreshFunc func() error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			slog.Error("refresh panicked", "cache", name, "panic", fmt.Sprint(p), "stack", string(debug.Stack()))
+			err = fmt.Errorf("refresh panicked: %v", p)
 		}
+	}()
+	return refreshFunc()
+}
+
+// recordRefreshResult resets a loop's failure count on success, or adds one on failure
+func recordRefreshResult(name string, err error) {
+	refreshLoopMutex.Lock()
+	defer refreshLoopMutex.Unlock()
+	if err != nil {
+		refreshLoopFailures[name]++
+	} else {
+		refreshLoopFailures[name] = 0
+	}
+}
+
+// refreshFailureCounts returns a copy of the consecutive failure counts, safe to encode without the lock
+func refreshFailureCounts() map[string]int {
+	refreshLoopMutex.Lock()
+	defer refreshLoopMutex.Unlock()
+	counts := make(map[string]int, len(refreshLoopFailures))
+	for name, n := range refreshLoopFailures {
+		counts[name] = n
+	}
+	return counts
+}
+
+// jitteredInterval returns interval shifted by a random amount within ±jitter (e.g. 0.1 = ±10%)
+func jitteredInterval(interval time.Duration, jitter float64, rng *rand.Rand) time.Duration {
+	if jitter <= 0 {
+		return interval
 	}
+	jitter = min(jitter, 0.9)                // Never let a wait shrink to (almost) nothing
+	offset := (rng.Float64()*2 - 1) * jitter // Uniform in [-jitter, +jitter)
+	return time.Duration(float64(interval) * (1 + offset))
 }
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Tests for the WMATA fetch + cache layer, run against a fake WMATA (httptest.Server) instead of the real API.
+
+const testAPIKey = "test-key"
+
+// fixtureWMATA answers like WMATA from the files in fixtures/, through fetchFixture, so jStationInfo,
+// per-station GetPrediction and radius searches behave like they do under DATA_SOURCE=fixtures
+func fixtureWMATA(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("api_key") != testAPIKey {
+			http.Error(w, "missing api_key", http.StatusUnauthorized)
+			return
+		}
+		body, err := fetchFixture(r.URL.String())
+		if err != nil {
+			t.Logf("fake WMATA: no fixture for %s: %v", r.URL, err)
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+}
+
+// startFakeWMATA serves handler on an httptest.Server, points wmataBaseURL at it and starts every cache cold
+// Everything it changes is put back when the test ends.
+func startFakeWMATA(t *testing.T, handler http.Handler) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	savedBaseURL, savedRateLimit, savedRPS, savedCacheFile := wmataBaseURL, wmataRateLimit, rateLimitRPS, staticCacheFile
+	t.Cleanup(func() {
+		wmataBaseURL, wmataRateLimit, rateLimitRPS, staticCacheFile = savedBaseURL, savedRateLimit, savedRPS, savedCacheFile
+		resetKeyPools()
+		resetCaches()
+	})
+	wmataBaseURL = server.URL
+	wmataRateLimit = 0 // No throttling, the fake server doesn't mind
+	resetKeyPools()    // So the test key's pool is rebuilt with that rate
+	rateLimitRPS = 0   // Same for our own per-client limit
+	staticCacheFile = filepath.Join(t.TempDir(), "static_cache.json")
+	resetCaches()
+	return server
+}
+
+// resetKeyPools forgets every parsed WMATA_API_KEY, along with each key's failures and limiter
+func resetKeyPools() {
+	apiKeyPoolMutex.Lock()
+	apiKeyPools = make(map[string]*apiKeyPool)
+	apiKeyPoolMutex.Unlock()
+}
+
+// resetCaches empties every cache the tests touch, as if the server had just started
+func resetCaches() {
+	staticCache = newMemoryCache[staticBundle]()
+	predictionCache = newMemoryCache[[]TrainPrediction]()
+	stationPredictionCache = newMemoryCache[[]TrainPrediction]()
+	outageCache = newMemoryCache[[]ElevatorIncident]()
+	incidentCache = newMemoryCache[[]Incident]()
+	busPredictionCache = newMemoryCache[BusPredictionsResponse]()
+
+	lineStationsMutex.Lock()
+	cachedLineStations = make(map[string]LineStations)
+	lineStationsMutex.Unlock()
+}
+
+func TestRefreshAllStationsFillsStaticCache(t *testing.T) {
+	startFakeWMATA(t, fixtureWMATA(t))
+
+	stations, err := refreshAllStations(context.Background(), testAPIKey)
+	if err != nil {
+		t.Fatalf("refreshAllStations: %v", err)
+	}
+
+	var stationsResp StationsResponse
+	var entrancesResp EntrancesResponse
+	var linesResp LinesResponse
+	var parkingResp StationsParkingResponse
+	readFixtureJSON(t, "stations.json", &stationsResp)
+	readFixtureJSON(t, "entrances.json", &entrancesResp)
+	readFixtureJSON(t, "lines.json", &linesResp)
+	readFixtureJSON(t, "parking.json", &parkingResp)
+
+	bundle := staticData()
+	if len(stations) != len(stationsResp.Stations) || len(bundle.Stations) != len(stationsResp.Stations) {
+		t.Errorf("got %d stations (%d cached), want %d", len(stations), len(bundle.Stations), len(stationsResp.Stations))
+	}
+	if len(bundle.Entrances) != len(entrancesResp.Entrances) || len(bundle.Entrances) == 0 {
+		t.Errorf("got %d entrances, want %d", len(bundle.Entrances), len(entrancesResp.Entrances))
+	}
+	if len(bundle.Lines) != len(linesResp.Lines) || len(bundle.Lines) == 0 {
+		t.Errorf("got %d lines, want %d", len(bundle.Lines), len(linesResp.Lines))
+	}
+	if len(bundle.Parking) != len(parkingResp.StationsParking) || len(bundle.Parking) == 0 {
+		t.Errorf("got %d parking records, want %d", len(bundle.Parking), len(parkingResp.StationsParking))
+	}
+	if bundle.StationsFetch.FetchedAt.IsZero() {
+		t.Error("StationsFetch.FetchedAt wasn't set")
+	}
+	if len(bundle.MissingStations) != 0 {
+		t.Errorf("missing stations %v, want none", bundle.MissingStations)
+	}
+	if bundle.Checksum == "" {
+		t.Error("Checksum wasn't set")
+	}
+	if station, ok := findStation(bundle.Stations, "A01"); !ok || station.Name != "Metro Center" {
+		t.Errorf("A01 = %+v, %v, want Metro Center", station, ok)
+	}
+	if len(bundle.StationsByLine["RD"]) == 0 || len(bundle.EntrancesByStation) == 0 {
+		t.Error("the indexes weren't built")
+	}
+}
+
+func TestFetchLinesRefetchSwapsWholeBundle(t *testing.T) {
+	startFakeWMATA(t, fixtureWMATA(t))
+	if _, err := refreshAllStations(context.Background(), testAPIKey); err != nil {
+		t.Fatalf("refreshAllStations: %v", err)
+	}
+
+	// Age just the lines past their TTL
+	before := staticData()
+	expired := before
+	expired.LinesFetch = staticDataset{FetchedAt: time.Now().Add(-2 * cacheTTL.Lines), AttemptedAt: time.Now().Add(-2 * cacheTTL.Lines)}
+	staticCache.Set(cacheKeyAll, expired)
+
+	lines, err := fetchLines(context.Background(), testAPIKey)
+	if err != nil || len(lines) == 0 {
+		t.Fatalf("fetchLines = %d lines, %v", len(lines), err)
+	}
+
+	after := staticData()
+	if time.Since(after.LinesFetch.FetchedAt) > time.Minute {
+		t.Errorf("LinesFetch.FetchedAt = %v, the lines weren't refetched", after.LinesFetch.FetchedAt)
+	}
+	// The rest of the bundle came along unchanged
+	if len(after.Stations) != len(before.Stations) || len(after.Entrances) != len(before.Entrances) ||
+		!after.StationsFetch.FetchedAt.Equal(before.StationsFetch.FetchedAt) || after.Checksum != before.Checksum {
+		t.Errorf("refetching the lines changed the rest of the bundle: %d stations, %d entrances, fetched %v",
+			len(after.Stations), len(after.Entrances), after.StationsFetch.FetchedAt)
+	}
+}
+
+// staticBody answers every request with a 200 and the same body, like WMATA on a bad day
+func staticBody(body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	})
+}
+
+// 200 responses that carry no data, each of which has to count as a failed fetch (see checkWMATABody)
+var noDataBodies = map[string]string{
+	"error message": `{"Message":"An error has occurred."}`,
+	"status object": `{"statusCode": 500, "message": "Internal server error"}`,
+	"empty object":  `{}`,
+	"null":          `null`,
+	"null trains":   `{"Trains":null}`,
+	"empty body":    ``,
+}
+
+func TestCheckWMATABody(t *testing.T) {
+	for name, body := range noDataBodies {
+		if name == "empty body" {
+			continue // Not JSON at all, that's for the real unmarshal to reject (see TestRefreshRejectsNoDataBodies)
+		}
+		if err := checkWMATABody([]byte(body)); err == nil {
+			t.Errorf("%s: checkWMATABody(%s) accepted it", name, body)
+		}
+	}
+	for _, body := range []string{`{"Trains":[]}`, `{"Trains":[{"Min":"3"}]}`, `{"Lines":[],"Message":"ignored"}`} {
+		if err := checkWMATABody([]byte(body)); err != nil {
+			t.Errorf("checkWMATABody(%s) = %v, want it accepted", body, err)
+		}
+	}
+}
+
+// backdatePredictions stores trains as if they had been fetched a minute ago, past refreshTrainPredictions'
+// one-second double-check, so the next refresh really calls (fake) WMATA
+func backdatePredictions(trains []TrainPrediction) {
+	predictionCache = backdated(trains, time.Minute)
+}
+
+// backdated returns a memory cache holding value under cacheKeyAll as if it had been Set age ago
+func backdated[V any](value V, age time.Duration) *memoryCache[V] {
+	cache := newMemoryCache[V]()
+	cache.entries[cacheKeyAll] = memoryCacheEntry[V]{value: value, setAt: time.Now().Add(-age)}
+	return cache
+}
+
+func TestRefreshRejectsNoDataBodies(t *testing.T) {
+	old := []TrainPrediction{{Min: "4", LocationCode: "A01"}, {Min: "BRD", LocationCode: "C01"}}
+
+	for name, body := range noDataBodies {
+		t.Run(name, func(t *testing.T) {
+			startFakeWMATA(t, staticBody(body))
+
+			backdatePredictions(old)
+			if _, err := refreshTrainPredictions(context.Background(), testAPIKey); err == nil {
+				t.Errorf("refreshTrainPredictions accepted %q", body)
+			}
+			if got, _ := predictionCache.Get(cacheKeyAll); len(got) != len(old) || got[0].Min != "4" {
+				t.Errorf("cached predictions changed to %+v", got)
+			}
+
+			// Static datasets too: the old lines are kept
+			bundle := staticBundle{Lines: []Lines{{LineCode: "RD", DisplayName: "Red"}}}
+			if err := refreshLines(context.Background(), testAPIKey, &bundle); err == nil {
+				t.Errorf("refreshLines accepted %q", body)
+			}
+			if len(bundle.Lines) != 1 || bundle.Lines[0].LineCode != "RD" {
+				t.Errorf("cached lines changed to %+v", bundle.Lines)
+			}
+		})
+	}
+}
+
+func TestRefreshAcceptsEmptyTrains(t *testing.T) {
+	// No trains at all (overnight) is a real answer and replaces the cache
+	startFakeWMATA(t, staticBody(`{"Trains":[]}`))
+	backdatePredictions([]TrainPrediction{{Min: "4", LocationCode: "A01"}})
+
+	trains, err := refreshTrainPredictions(context.Background(), testAPIKey)
+	if err != nil {
+		t.Fatalf("refreshTrainPredictions: %v", err)
+	}
+	if len(trains) != 0 {
+		t.Errorf("got %d trains, want 0", len(trains))
+	}
+	if got, ok := predictionCache.Get(cacheKeyAll); !ok || len(got) != 0 {
+		t.Errorf("cache = %+v (stored %v), want an empty list", got, ok)
+	}
+}
+
+// failStationInfo serves the fixtures, except that every jStationInfo call fails
+func failStationInfo(t *testing.T) http.Handler {
+	fixtures := fixtureWMATA(t)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/Rail.svc/json/jStationInfo" {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		fixtures.ServeHTTP(w, r)
+	})
+}
+
+func TestRefreshFailsWhenEveryStationDetailFails(t *testing.T) {
+	startFakeWMATA(t, failStationInfo(t))
+	savedDelay := stationRetryDelay
+	defer func() { stationRetryDelay = savedDelay }()
+	stationRetryDelay = time.Millisecond
+
+	if _, err := refreshAllStations(context.Background(), testAPIKey); err == nil {
+		t.Fatal("refreshAllStations succeeded with every jStationInfo call failing")
+	}
+	bundle := staticData()
+	stations, fetchedAt := bundle.Stations, bundle.StationsFetch.FetchedAt
+	if stations != nil || !fetchedAt.IsZero() {
+		t.Errorf("cache was set to %d stations (at %v), want it left unset", len(stations), fetchedAt)
+	}
+
+	// And the handler says so instead of answering 200 []
+	resetCaches()
+	if rec := serve("/stations"); rec.Code < 500 {
+		t.Errorf("/stations: status %d (%s), want 5xx", rec.Code, rec.Body.String())
+	}
+}
+
+func TestFetchOutagesServesStaleOnFailure(t *testing.T) {
+	startFakeWMATA(t, staticBody(`{"Message":"An error has occurred."}`))
+
+	// Nothing cached yet: the failure is an error
+	if _, err := fetchOutages(context.Background(), testAPIKey); err == nil {
+		t.Fatal("fetchOutages succeeded against a failing WMATA with nothing cached")
+	}
+
+	// An expired list is served instead of the error, and the failure shows up in /stats
+	old := []ElevatorIncident{{StationCode: "A01", UnitType: "ELEVATOR"}}
+	outageCache = backdated(old, 2*cacheTTL.Outages)
+	outages, err := fetchOutages(context.Background(), testAPIKey)
+	if err != nil {
+		t.Fatalf("fetchOutages = %v, want the previous list", err)
+	}
+	if len(outages) != 1 || outages[0].StationCode != "A01" {
+		t.Errorf("got %+v, want the previous list", outages)
+	}
+	if stats := refreshStatsSnapshot()["outages"]; stats.Success || stats.LastError == "" {
+		t.Errorf("/stats outages = %+v, want the failure recorded", stats)
+	}
+}
+
+func TestFetchIncidentsServesStaleOnFailure(t *testing.T) {
+	startFakeWMATA(t, staticBody(`null`))
+
+	if _, err := fetchIncidents(context.Background(), testAPIKey); err == nil {
+		t.Fatal("fetchIncidents succeeded against a failing WMATA with nothing cached")
+	}
+
+	incidentCache = backdated([]Incident{{IncidentID: "1", LinesAffected: "RD;"}}, 2*cacheTTL.Incidents)
+	incidents, err := fetchIncidents(context.Background(), testAPIKey)
+	if err != nil || len(incidents) != 1 || incidents[0].IncidentID != "1" {
+		t.Errorf("fetchIncidents = %+v, %v, want the previous list", incidents, err)
+	}
+	if stats := refreshStatsSnapshot()["incidents"]; stats.Success || stats.LastError == "" {
+		t.Errorf("/stats incidents = %+v, want the failure recorded", stats)
+	}
+}
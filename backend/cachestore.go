@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Cache is where fetched WMATA data is stored, keyed by station code, stop ID, or cacheKeyAll for one-value caches.
+// The fetch functions in cache.go only go through this interface, so a shared backend (e.g. Redis, for several
+// instances behind a load balancer) can replace memoryCache without touching them or the handlers.
+// Generic over the value type like lruCache, a Redis version would JSON-encode V.
+//
+// The static data (stations, lines, ...) is one staticBundle under cacheKeyAll, swapped in whole on refresh.
+// Not behind it (yet): the bounded LRUs for paths, travel times and nearby entrances.
+type Cache[V any] interface {
+	Get(key string) (V, bool)             // The stored value, false if there is none
+	Set(key string, value V)              // Stores value, resetting its age
+	Age(key string) (time.Duration, bool) // Time since key was last Set, false if there is none
+}
+
+// Key for caches that hold a single value (all predictions, all outages, ...)
+const cacheKeyAll = "all"
+
+// memoryCache is the default Cache: a map in this process's memory, which is how everything was cached before
+type memoryCache[V any] struct {
+	mu      sync.RWMutex
+	entries map[string]memoryCacheEntry[V]
+}
+
+// memoryCacheEntry is one stored value and when it was stored
+type memoryCacheEntry[V any] struct {
+	value V
+	setAt time.Time
+}
+
+// newMemoryCache creates an empty in-memory cache
+func newMemoryCache[V any]() *memoryCache[V] {
+	return &memoryCache[V]{entries: make(map[string]memoryCacheEntry[V])}
+}
+
+// Get returns the value stored for key
+func (c *memoryCache[V]) Get(key string) (V, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[key]
+	return entry.value, ok
+}
+
+// Set stores value for key, replacing (and re-timing) any older one
+func (c *memoryCache[V]) Set(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = memoryCacheEntry[V]{value: value, setAt: time.Now()}
+}
+
+// Age returns how long ago key was stored
+func (c *memoryCache[V]) Age(key string) (time.Duration, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return 0, false
+	}
+	return time.Since(entry.setAt), true
+}
+
+// getFresh returns key's value only if it was stored less than maxAge ago (the usual TTL check)
+func getFresh[V any](c Cache[V], key string, maxAge time.Duration) (V, bool) {
+	if age, ok := c.Age(key); !ok || age >= maxAge {
+		var zero V
+		return zero, false
+	}
+	return c.Get(key)
+}
+
+// cacheFetchedAt turns key's Age back into a timestamp for X-Cache-Age and /health (zero time if it isn't stored)
+func cacheFetchedAt[V any](c Cache[V], key string) time.Time {
+	age, ok := c.Age(key)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Now().Add(-age)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Response encoding: JSON by default, MessagePack (https://msgpack.org, a binary JSON) when the client
+// asks for it with "Accept: application/msgpack". Smaller and faster to parse on low-bandwidth mobile clients,
+// which matters most for the big /stations and /nexttrains responses. Error responses always stay JSON.
+
+const msgpackContentType = "application/msgpack"
+
+// wantsMsgPack reports whether the Accept header asks for MessagePack
+// Only an explicit application/msgpack (or the older application/x-msgpack) counts, */* still means JSON.
+func wantsMsgPack(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err == nil && (mediaType == msgpackContentType || mediaType == "application/x-msgpack") {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeResponse encodes data in the format the request asked for, returning the body and its Content-Type
+// The one place the encoder is chosen, so every handler using writeJSON / writeJSONCached gets both formats.
+func encodeResponse(r *http.Request, data interface{}) ([]byte, string, error) {
+	if wantsMsgPack(r) {
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		enc.SetCustomStructTag("json") // Reuse the json tags, so field names match the JSON responses exactly
+		if err := enc.Encode(data); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), msgpackContentType, nil
+	}
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, "", err
+	}
+	return append(body, '\n'), "application/json", nil // Trailing newline, like json.Encoder
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DATA_SOURCE=fixtures: answer every WMATA call from the JSON files in fixtures/ instead of the API.
+// The hook is in fetchFromWMATA, so the refresh functions, caches and handlers run exactly as they do live.
+// Handy for offline demos and frontend work without an API key or burning WMATA quota.
+// The bundled files cover a handful of downtown stations, and endpoints without a fixture (jPath) return errNoFixture.
+
+const (
+	dataSourceLive     = "live"
+	dataSourceFixtures = "fixtures"
+)
+
+var (
+	dataSource  = dataSourceLive // Overridable via DATA_SOURCE, see main.go
+	fixturesDir = "fixtures"     // Overridable via FIXTURES_DIR
+)
+
+var errNoFixture = errors.New("no fixture for this WMATA endpoint")
+
+// fixtureFiles maps each WMATA endpoint path to the file holding its response
+// jStationInfo and per-station GetPrediction calls are answered from stations.json / predictions.json instead,
+// see fetchFixture.
+var fixtureFiles = map[string]string{
+	"/Rail.svc/json/jStations":                      "stations.json",
+	"/Rail.svc/json/jLines":                         "lines.json",
+	"/Rail.svc/json/jStationEntrances":              "entrances.json",
+	"/Rail.svc/json/jStationParking":                "parking.json",
+	"/Rail.svc/json/jStationTimes":                  "station_times.json",
+	"/StationPrediction.svc/json/GetPrediction/All": "predictions.json",
+	"/Incidents.svc/json/ElevatorIncidents":         "elevator_incidents.json",
+	"/Incidents.svc/json/Incidents":                 "incidents.json",
+	"/NextBusService.svc/json/jPredictions":         "bus_predictions.json", // Same stop for every StopID
+}
+
+// usingFixtures reports whether WMATA calls are served from fixtures/
+func usingFixtures() bool {
+	return dataSource == dataSourceFixtures
+}
+
+// readFixture returns one fixture file's contents
+func readFixture(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(fixturesDir, name))
+}
+
+// fetchFixture is fetchFromWMATA's stand-in under DATA_SOURCE=fixtures, returning the body WMATA would have sent
+func fetchFixture(rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+
+	switch {
+	case u.Path == "/Rail.svc/json/jStationInfo":
+		return stationInfoFixture(query.Get("StationCode"))
+	case strings.HasPrefix(u.Path, "/StationPrediction.svc/json/GetPrediction/") && !strings.HasSuffix(u.Path, "/All"):
+		return stationPredictionsFixture(strings.Split(strings.TrimPrefix(u.Path, "/StationPrediction.svc/json/GetPrediction/"), ","))
+	case u.Path == "/Rail.svc/json/jStationEntrances" && query.Has("Lat"):
+		return nearbyEntrancesFixture(query)
+	}
+
+	name, ok := fixtureFiles[u.Path]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errNoFixture, u.Path)
+	}
+	return readFixture(name)
+}
+
+// stationInfoFixture answers jStationInfo from stations.json, which has the same fields for every station
+func stationInfoFixture(code string) ([]byte, error) {
+	data, err := readFixture(fixtureFiles["/Rail.svc/json/jStations"])
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Stations []StationInfo `json:"Stations"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	station, ok := findStation(resp.Stations, code)
+	if !ok {
+		return nil, &wmataStatusError{StatusCode: 404} // What WMATA would answer for an unknown code
+	}
+	return json.Marshal(station)
+}
+
+// stationPredictionsFixture answers GetPrediction/A01,C01 with the matching trains from predictions.json
+func stationPredictionsFixture(codes []string) ([]byte, error) {
+	data, err := readFixture(fixtureFiles["/StationPrediction.svc/json/GetPrediction/All"])
+	if err != nil {
+		return nil, err
+	}
+	var resp TrainPredictionsResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	resp.Trains = filterPredictionsByCode(resp.Trains, codes)
+	return json.Marshal(resp)
+}
+
+// nearbyEntrancesFixture answers a jStationEntrances radius search by filtering entrances.json
+func nearbyEntrancesFixture(query url.Values) ([]byte, error) {
+	lat, latErr := strconv.ParseFloat(query.Get("Lat"), 64)
+	lon, lonErr := strconv.ParseFloat(query.Get("Lon"), 64)
+	radius, radiusErr := strconv.ParseFloat(query.Get("Radius"), 64)
+	if latErr != nil || lonErr != nil || radiusErr != nil {
+		return nil, &wmataStatusError{StatusCode: 400}
+	}
+
+	data, err := readFixture(fixtureFiles["/Rail.svc/json/jStationEntrances"])
+	if err != nil {
+		return nil, err
+	}
+	var resp EntrancesResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	nearby := []StationEntrance{}
+	for _, entrance := range resp.Entrances {
+		if haversineMeters(lat, lon, entrance.Lat, entrance.Lon) <= radius {
+			nearby = append(nearby, entrance)
+		}
+	}
+	return json.Marshal(EntrancesResponse{Entrances: nearby})
+}
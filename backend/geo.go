@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// Helpers for distance calculations (walkability features)
+
+const defaultWalkRadiusMeters = 800.0 // Roughly a 10-minute walk
+
+const earthRadiusMeters = 6371000.0
+
+// haversineMeters returns the great-circle distance between two lat/lon points in meters
+// Haversine formula: treats the Earth as a sphere, accurate to well under 1% at city scale.
+func haversineMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	toRadians := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return earthRadiusMeters * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// parseLatLon reads and validates the ?lat= and ?lon= query params
+func parseLatLon(r *http.Request) (float64, float64, error) {
+	lat, err := strconv.ParseFloat(r.URL.Query().Get("lat"), 64)
+	if err != nil || math.IsNaN(lat) || lat < -90 || lat > 90 {
+		return 0, 0, errors.New("lat must be a number between -90 and 90")
+	}
+	lon, err := strconv.ParseFloat(r.URL.Query().Get("lon"), 64)
+	if err != nil || math.IsNaN(lon) || lon < -180 || lon > 180 {
+		return 0, 0, errors.New("lon must be a number between -180 and 180")
+	}
+	return lat, lon, nil
+}
+
+// parseRadius reads and validates the optional ?radius= (meters), defaulting to defaultWalkRadiusMeters
+func parseRadius(r *http.Request) (float64, error) {
+	radiusParam := r.URL.Query().Get("radius")
+	if radiusParam == "" {
+		return defaultWalkRadiusMeters, nil
+	}
+	radius, err := strconv.ParseFloat(radiusParam, 64)
+	if err != nil || !(radius > 0) || math.IsInf(radius, 0) { // !(radius > 0) also catches NaN
+		return 0, errors.New("radius must be a positive number of meters")
+	}
+	return radius, nil
+}
+
+// boundingBox is a lat/lon rectangle, e.g. the map viewport (/stations/bbox)
+type boundingBox struct {
+	minLat, minLon, maxLat, maxLon float64
+}
+
+// parseBoundingBox reads and validates ?minLat=&minLon=&maxLat=&maxLon=
+// Each corner must be in range and min must be below max. A box crossing the antimeridian can't be expressed,
+// which is fine for a DC map.
+func parseBoundingBox(r *http.Request) (boundingBox, error) {
+	parse := func(name string, limit float64) (float64, error) {
+		value, err := strconv.ParseFloat(r.URL.Query().Get(name), 64)
+		if err != nil || math.IsNaN(value) || value < -limit || value > limit {
+			return 0, fmt.Errorf("%s must be a number between %g and %g", name, -limit, limit)
+		}
+		return value, nil
+	}
+
+	var box boundingBox
+	var err error
+	if box.minLat, err = parse("minLat", 90); err != nil {
+		return box, err
+	}
+	if box.minLon, err = parse("minLon", 180); err != nil {
+		return box, err
+	}
+	if box.maxLat, err = parse("maxLat", 90); err != nil {
+		return box, err
+	}
+	if box.maxLon, err = parse("maxLon", 180); err != nil {
+		return box, err
+	}
+	if box.minLat >= box.maxLat || box.minLon >= box.maxLon {
+		return box, errors.New("minLat and minLon must be less than maxLat and maxLon")
+	}
+	return box, nil
+}
+
+// contains reports whether the point is inside the box (edges count as inside)
+func (box boundingBox) contains(lat, lon float64) bool {
+	return lat >= box.minLat && lat <= box.maxLat && lon >= box.minLon && lon <= box.maxLon
+}
+
+// stationsInBounds returns the stations inside the box, in the cache's order
+func stationsInBounds(stations []StationInfo, box boundingBox) []StationInfo {
+	inside := []StationInfo{} // Non-nil so an empty viewport encodes as [] instead of null
+	for _, station := range stations {
+		if box.contains(station.Lat, station.Lon) {
+			inside = append(inside, station)
+		}
+	}
+	return inside
+}
+
+// stationsByDistance returns every station with its distance from the point, closest first
+func stationsByDistance(stations []StationInfo, lat, lon float64) []NearbyStation {
+	nearby := make([]NearbyStation, 0, len(stations))
+	for _, station := range stations {
+		lines := stationLines(station)
+		if lines == nil {
+			lines = []string{}
+		}
+		nearby = append(nearby, NearbyStation{
+			StationInfo:    station,
+			DistanceMeters: haversineMeters(lat, lon, station.Lat, station.Lon),
+			Lines:          lines,
+		})
+	}
+	sort.SliceStable(nearby, func(i, j int) bool {
+		return nearby[i].DistanceMeters < nearby[j].DistanceMeters
+	})
+	return nearby
+}
+
+// entrancesByDistance returns the entrances with their distance from the point, closest first (/entrances?lat=&lon=)
+func entrancesByDistance(entrances []StationEntrance, lat, lon float64) []NearbyEntrance {
+	nearby := make([]NearbyEntrance, 0, len(entrances))
+	for _, entrance := range entrances {
+		nearby = append(nearby, NearbyEntrance{
+			StationEntrance: entrance,
+			DistanceMeters:  haversineMeters(lat, lon, entrance.Lat, entrance.Lon),
+		})
+	}
+	sort.SliceStable(nearby, func(i, j int) bool {
+		return nearby[i].DistanceMeters < nearby[j].DistanceMeters
+	})
+	return nearby
+}
+
+// stationsWithin returns the stations within radiusMeters of the point, closest first (/walkshed)
+func stationsWithin(stations []StationInfo, lat, lon, radiusMeters float64) []NearbyStation {
+	within := []NearbyStation{}
+	for _, station := range stationsByDistance(stations, lat, lon) {
+		if station.DistanceMeters > radiusMeters {
+			break // Sorted by distance, so everything after this is further away too
+		}
+		within = append(within, station)
+	}
+	return within
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseRadius(t *testing.T) {
+	tests := []struct {
+		query  string
+		want   float64
+		wantOK bool
+	}{
+		{"", defaultWalkRadiusMeters, true},
+		{"?radius=250", 250, true},
+		{"?radius=1.5", 1.5, true},
+		{"?radius=0", 0, false},
+		{"?radius=-100", 0, false},
+		{"?radius=NaN", 0, false},
+		{"?radius=Inf", 0, false},
+		{"?radius=far", 0, false},
+	}
+
+	for _, tt := range tests {
+		radius, err := parseRadius(httptest.NewRequest("GET", "/walkshed"+tt.query, nil))
+		if (err == nil) != tt.wantOK {
+			t.Errorf("parseRadius(%q) error = %v, want ok %v", tt.query, err, tt.wantOK)
+			continue
+		}
+		if err == nil && radius != tt.want {
+			t.Errorf("parseRadius(%q) = %g, want %g", tt.query, radius, tt.want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Helpers for building GeoJSON (https://geojson.org) from live cache data, and serving the static files
+
+// How long browsers may reuse the static GeoJSON files without asking again, overridable via GEOJSON_MAX_AGE
+var geojsonMaxAge = 24 * time.Hour
+
+// The bundled GeoJSON files, checked once at startup by validateGeoJSONFiles
+const (
+	stationsGeoJSONFile = "Metro_Rail_Stations.geojson"
+	linesGeoJSONFile    = "Metro_Rail_Lines.geojson"
+)
+
+// invalidGeoJSONFiles maps each bundled file that failed validation to why. Written once by
+// validateGeoJSONFiles before the handlers are registered and only read afterwards, so no mutex is needed.
+var invalidGeoJSONFiles = map[string]error{}
+
+// validateGeoJSONFiles parses each bundled GeoJSON file, so a broken edit shows up in the logs at boot
+// instead of as a blank map in the browser. Files that fail are answered with a 500 by serveGeoJSONFile.
+func validateGeoJSONFiles() {
+	for _, path := range []string{stationsGeoJSONFile, linesGeoJSONFile} {
+		features, err := validateGeoJSONFile(path)
+		if err != nil {
+			slog.Error("invalid GeoJSON file, its endpoint will answer 500", "file", path, "err", err)
+			invalidGeoJSONFiles[path] = err
+			continue
+		}
+		slog.Debug("GeoJSON file ok", "file", path, "features", features)
+	}
+}
+
+// validateGeoJSONFile checks the file is a FeatureCollection whose features all have a geometry with
+// coordinates, returning how many features it has. Properties aren't checked, the frontend reads those loosely.
+func validateGeoJSONFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var collection GeoJSONFeatureCollection
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return 0, fmt.Errorf("parse: %w", err)
+	}
+	if collection.Type != "FeatureCollection" {
+		return 0, fmt.Errorf("type is %q, want FeatureCollection", collection.Type)
+	}
+	if len(collection.Features) == 0 {
+		return 0, errors.New("no features")
+	}
+	for i, feature := range collection.Features {
+		if feature.Type != "Feature" {
+			return 0, fmt.Errorf("feature %d: type is %q, want Feature", i, feature.Type)
+		}
+		switch feature.Geometry.Type {
+		case "Point", "MultiPoint", "LineString", "MultiLineString", "Polygon", "MultiPolygon":
+		default:
+			return 0, fmt.Errorf("feature %d: unknown geometry type %q", i, feature.Geometry.Type)
+		}
+		// Coordinates decode as []interface{} for any JSON array, whatever the nesting
+		if coords, ok := feature.Geometry.Coordinates.([]interface{}); !ok || len(coords) == 0 {
+			return 0, fmt.Errorf("feature %d: missing coordinates", i)
+		}
+	}
+	return len(collection.Features), nil
+}
+
+// serveGeoJSONFile serves one of the static GeoJSON files with a Cache-Control max-age
+// http.ServeFile sets Last-Modified from the file's modtime and answers If-Modified-Since with a 304 itself,
+// so the browser revalidates cheaply once max-age runs out instead of downloading the whole file again.
+func serveGeoJSONFile(w http.ResponseWriter, r *http.Request, path string) {
+	if !geojsonFileUsable(w, path) {
+		return
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(geojsonMaxAge.Seconds())))
+	http.ServeFile(w, r, path)
+}
+
+// geojsonFileUsable writes a 500 and returns false if the file failed validateGeoJSONFiles
+// A clear error beats handing the browser a file its map library will choke on.
+func geojsonFileUsable(w http.ResponseWriter, path string) bool {
+	if err, bad := invalidGeoJSONFiles[path]; bad {
+		writeError(w, fmt.Sprintf("%s is not valid GeoJSON: %v", path, err), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// stationsGeoJSON turns stations into a FeatureCollection of Points (/geojson/stations?live=true)
+// Note GeoJSON coordinates are [lon, lat], the opposite order to most of the code.
+func stationsGeoJSON(stations []StationInfo) GeoJSONFeatureCollection {
+	collection := GeoJSONFeatureCollection{Type: "FeatureCollection", Features: []GeoJSONFeature{}}
+	for _, station := range stations {
+		lines := stationLines(station)
+		if lines == nil {
+			lines = []string{} // Encode as [] rather than null
+		}
+		collection.Features = append(collection.Features, GeoJSONFeature{
+			Type: "Feature",
+			Geometry: GeoJSONGeometry{
+				Type:        "Point",
+				Coordinates: []float64{station.Lon, station.Lat},
+			},
+			Properties: map[string]interface{}{
+				"code":  station.Code,
+				"name":  station.Name,
+				"lines": lines,
+			},
+		})
+	}
+	return collection
+}
+
+// linesGeoJSON builds one feature per line by joining its stations in order (/geojson/lines?live=true)
+// The order comes from lineStations (jPath, cached forever), so this only calls WMATA the first time.
+// A line with branches is a MultiLineString (main run first, then each branch), otherwise a LineString.
+// The shape is station to station in straight segments, coarser than the surveyed track in the bundled file.
+func linesGeoJSON(ctx context.Context, apiKey string, lines []Lines, stations []StationInfo) (GeoJSONFeatureCollection, error) {
+	collection := GeoJSONFeatureCollection{Type: "FeatureCollection", Features: []GeoJSONFeature{}}
+	for _, line := range lines {
+		ordered, err := lineStations(ctx, apiKey, stations, line)
+		if err != nil {
+			return GeoJSONFeatureCollection{}, err
+		}
+
+		runs := [][][]float64{stationCoordinates(ordered.Stations)}
+		for _, branch := range ordered.Branches {
+			runs = append(runs, stationCoordinates(branch.Stations))
+		}
+		geometry := GeoJSONGeometry{Type: "LineString", Coordinates: runs[0]}
+		if len(runs) > 1 {
+			geometry = GeoJSONGeometry{Type: "MultiLineString", Coordinates: runs}
+		}
+
+		collection.Features = append(collection.Features, GeoJSONFeature{
+			Type:     "Feature",
+			Geometry: geometry,
+			Properties: map[string]interface{}{
+				"code":  line.LineCode,
+				"name":  line.DisplayName,
+				"color": lineColorHex(LineCode(line.LineCode)),
+			},
+		})
+	}
+	return collection, nil
+}
+
+// liveLinesGeoJSON fetches the lines and stations from the cache and builds linesGeoJSON from them
+func liveLinesGeoJSON(ctx context.Context, apiKey string) (GeoJSONFeatureCollection, error) {
+	stations, err := fetchAllStations(ctx, apiKey)
+	if err != nil {
+		return GeoJSONFeatureCollection{}, err
+	}
+	lines, err := fetchLines(ctx, apiKey)
+	if err != nil {
+		return GeoJSONFeatureCollection{}, err
+	}
+	return linesGeoJSON(ctx, apiKey, lines, stations)
+}
+
+// stationCoordinates lists each station's [lon, lat], in order
+func stationCoordinates(stations []StationInfo) [][]float64 {
+	coords := make([][]float64, 0, len(stations))
+	for _, station := range stations {
+		coords = append(coords, []float64{station.Lon, station.Lat})
+	}
+	return coords
+}
@@ -1,9 +1,21 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // Helper function to set CORS headers and handle preflight requests
@@ -23,37 +35,298 @@ func handleCORS(w http.ResponseWriter, r *http.Request) bool {
 	return false
 }
 
-// Helper function to write JSON responses
-func writeJSON(w http.ResponseWriter, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
+// Helper function to write JSON responses (or MessagePack if the client asked for it, see encodeResponse)
+func writeJSON(w http.ResponseWriter, r *http.Request, data interface{}) {
+	writeJSONStatus(w, r, data, http.StatusOK)
+}
+
+// Helper function to write GeoJSON responses (same as writeJSON, with the GeoJSON content type)
+func writeGeoJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/geo+json")
 	json.NewEncoder(w).Encode(data)
 }
 
+// Helper function to write JSON responses with a non-200 status code (e.g. 503 from /health)
+func writeJSONStatus(w http.ResponseWriter, r *http.Request, data interface{}, code int) {
+	body, contentType, err := encodeResponse(r, data)
+	if err != nil {
+		requestLogger(r).Error("encoding response failed", "err", err)
+		writeError(w, "Encoding failed", 500)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept") // The body depends on Accept, so caches mustn't mix up the formats
+	w.WriteHeader(code)              // Must come after setting headers, headers can't change once the status is sent
+	w.Write(body)
+}
+
+// Helper function to write JSON responses with an ETag, for data that rarely changes (/stations, /lines, /parking)
+// The ETag is a hash of the encoded body. If the browser already has that exact version
+// (sends it back in If-None-Match), reply 304 Not Modified with no body and save the bandwidth.
+func writeJSONCached(w http.ResponseWriter, r *http.Request, data interface{}) {
+	body, contentType, err := encodeResponse(r, data)
+	if err != nil {
+		requestLogger(r).Error("encoding response failed", "err", err)
+		writeError(w, "Encoding failed", 500)
+		return
+	}
+
+	// Hashing the encoded body means JSON and MessagePack versions get different ETags, as they should
+	sum := sha256.Sum256(body)
+	etag := fmt.Sprintf(`"%x"`, sum[:16]) // ETags are quoted strings per the HTTP spec
+	w.Header().Set("ETag", etag)
+	w.Header().Add("Vary", "Accept")
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+// etagMatches checks an If-None-Match header value (can be "*" or a comma-separated list) against our ETag
+func etagMatches(ifNoneMatch string, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		candidate = strings.TrimPrefix(candidate, "W/") // Weak comparison is fine for GET
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper function to write one Server-Sent Events message ("data: <json>" followed by a blank line)
+func writeSSE(w http.ResponseWriter, data interface{}) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", body)
+	return err
+}
+
+// Helper function for a failed cache fetch: nothing if the client has gone, 503 + Retry-After while warming up,
+// otherwise logs the error and sends a 500 with msg
+func writeFetchError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	// The client went away mid-fetch (r.Context() was cancelled), nobody is left to answer
+	if errors.Is(err, context.Canceled) && r.Context().Err() != nil {
+		requestLogger(r).Debug("client cancelled request during fetch")
+		return
+	}
+	if errors.Is(err, errWarmingUp) {
+		w.Header().Set("Retry-After", "5")
+		writeError(w, "Server is starting up, try again shortly", http.StatusServiceUnavailable)
+		return
+	}
+	requestLogger(r).Error("fetch failed", "err", err)
+	writeError(w, msg, 500)
+}
+
 // Helper function to write error responses
+// Errors are JSON too ({"error": "...", "code": 400}), so the frontend can parse every response the same way.
 func writeError(w http.ResponseWriter, msg string, code int) {
-	http.Error(w, msg, code)
+	// Always JSON (never MessagePack), so errors look the same whatever the client asked for
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: msg, Code: code})
 }
 
 // Generic handler wrapper (reduces boilerplate in handlers)
+// Also gives every request an ID and a logger carrying it (see requestLogger), logs a summary line when done,
+// and applies the per-client rate limit (see ratelimit.go).
 func apiHandler(apiKey string, handler func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if handleCORS(w, r) {
+		start := time.Now()
+		requestID := newRequestID()
+		logger := slog.Default().With("request_id", requestID, "method", r.Method, "path", r.URL.Path)
+		r = withRequestLogger(r, logger)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK} // 200 unless the handler says otherwise
+		rec.Header().Set("X-Request-ID", requestID)
+		defer logRequest(logger, rec, start)
+		defer recoverPanic(rec, r) // Deferred after logRequest so it runs first, and the summary line shows the 500
+
+		if handleCORS(rec, r) {
 			return
 		}
-		handler(w, r, apiKey)
+		if checkRateLimit(rec, r) {
+			return
+		}
+		handler(rec, r, apiKey)
+	}
+}
+
+// recoverPanic turns a panic in a handler into a logged stack trace and a 500, instead of a dropped connection
+// Must be deferred (recover only works inside a deferred call). If the handler already started its response,
+// the status can't be changed any more, so the stack trace is all we can do.
+func recoverPanic(rec *statusRecorder, r *http.Request) {
+	err := recover()
+	if err == nil {
+		return
+	}
+	if err == http.ErrAbortHandler {
+		panic(err) // Deliberate abort, net/http handles this one quietly
+	}
+	requestLogger(r).Error("handler panicked", "panic", fmt.Sprint(err), "stack", string(debug.Stack()))
+	if rec.wroteHeader {
+		return
+	}
+	writeError(rec, "Internal server error", http.StatusInternalServerError)
+}
+
+// Helper function for the opt-in ?envelope=true response shape: {"data": ..., "generatedAt": "..."}
+// generatedAt is when the served data was fetched from WMATA (RFC3339), the same moment X-Cache-Age counts from.
+// Without the param the data is returned as-is, so existing clients keep getting bare arrays.
+func withEnvelope(r *http.Request, data interface{}, fetchedAt time.Time) interface{} {
+	if r.URL.Query().Get("envelope") != "true" {
+		return data
+	}
+	if fetchedAt.IsZero() {
+		fetchedAt = time.Now() // Nothing cached to date it by, so it was just generated
+	}
+	return Envelope{Data: data, GeneratedAt: fetchedAt.UTC()}
+}
+
+// Helper function to set X-Cache-Age: how many seconds old the served data is
+// Lets the frontend show a "data may be stale" banner when WMATA is down and we keep serving the old cache.
+func setCacheAge(w http.ResponseWriter, fetchedAt time.Time) {
+	if fetchedAt.IsZero() {
+		return
+	}
+	w.Header().Set("X-Cache-Age", strconv.Itoa(int(time.Since(fetchedAt).Seconds())))
+}
+
+// Helper function to check an incident's LinesAffected (like "BL; OR;") for a line code
+// Splits on ";" and compares whole codes, so "RD" can't accidentally match inside another code.
+func incidentAffectsLine(incident Incident, lineCode LineCode) bool {
+	for _, affected := range strings.Split(incident.LinesAffected, ";") {
+		if strings.EqualFold(strings.TrimSpace(affected), string(lineCode)) {
+			return true
+		}
 	}
+	return false
+}
+
+// parseStationPair reads ?from= and ?to= for /path and /traveltime, writing the error itself if they're unusable
+// Both codes are checked against the station cache before spending a WMATA call, and from == to is refused
+// up front since WMATA fails on it (which would reach the client as a 500).
+func parseStationPair(w http.ResponseWriter, r *http.Request, key string) (string, string, bool) {
+	fromCode := r.URL.Query().Get("from")
+	toCode := r.URL.Query().Get("to")
+	if fromCode == "" || toCode == "" {
+		writeError(w, "Missing from or to station code", 400)
+		return "", "", false
+	}
+	if fromCode == toCode {
+		writeError(w, "from and to must be different stations", 400)
+		return "", "", false
+	}
+
+	stations, err := fetchAllStations(r.Context(), key)
+	if err != nil {
+		writeFetchError(w, r, err, "Cache fetch failed")
+		return "", "", false
+	}
+	for _, code := range []string{fromCode, toCode} {
+		if _, ok := findStation(stations, code); !ok {
+			writeError(w, "Unknown station code: "+code, 400)
+			return "", "", false
+		}
+	}
+	return fromCode, toCode, true
 }
 
 func registerHandlers(apiKey string) {
 	// Handler for /stations
 	http.HandleFunc("/stations", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
-		detailedStations, err := fetchAllStations(key)
+		detailedStations, err := fetchAllStations(r.Context(), key)
+		if err != nil {
+			writeFetchError(w, r, err, "API fetch failed")
+			return
+		}
+		fetchedAt := staticFetchedAt()
+		setCacheAge(w, fetchedAt)
+		// Some stations' details couldn't be fetched, so they're missing from the list (the codes are in /health)
+		if missing, _ := missingStationData(); len(missing) > 0 {
+			w.Header().Set("X-Partial-Data", strconv.Itoa(len(missing)))
+		}
+
+		// Optional ?stepfree=true: only stations with every elevator in service (see stepFreeStations)
+		// If the outage data can't be fetched, every station is returned instead of an error, since the list is
+		// still useful. X-Stepfree-Filter says which happened: "applied" or "unavailable".
+		if r.URL.Query().Get("stepfree") == "true" {
+			outages, err := fetchOutages(r.Context(), key)
+			if err != nil {
+				requestLogger(r).Warn("no outage data, returning stations unfiltered", "filter", "stepfree", "err", err)
+				w.Header().Set("X-Stepfree-Filter", "unavailable")
+			} else {
+				detailedStations = stepFreeStations(detailedStations, outages)
+				w.Header().Set("X-Stepfree-Filter", "applied")
+			}
+		}
+
+		// Optional ?merge=true: one entry per transfer complex instead of one per platform code
+		merge := r.URL.Query().Get("merge") == "true"
+		// Optional ?fields=Code,Name,Lat,Lon: only include these StationInfo fields (smaller payload)
+		fieldsParam := r.URL.Query().Get("fields")
+
+		if merge && fieldsParam != "" {
+			writeError(w, "fields can't be combined with merge", 400)
+			return
+		}
+		if merge {
+			writeJSONCached(w, r, withEnvelope(r, mergeStations(detailedStations), fetchedAt))
+			return
+		}
+		if fieldsParam != "" {
+			projected, err := projectStations(detailedStations, fieldsParam)
+			if err != nil {
+				writeError(w, err.Error(), 400)
+				return
+			}
+			writeJSONCached(w, r, withEnvelope(r, projected, fetchedAt))
+			return
+		}
+		writeJSONCached(w, r, withEnvelope(r, detailedStations, fetchedAt))
+	}))
+
+	// Handler for /stations.csv - station list as a spreadsheet-friendly CSV download
+	http.HandleFunc("/stations.csv", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		detailedStations, err := fetchAllStations(r.Context(), key)
 		if err != nil {
-			log.Println("ERROR /stations:", err)
-			writeError(w, "API fetch failed", 500)
+			writeFetchError(w, r, err, "API fetch failed")
 			return
 		}
-		writeJSON(w, detailedStations)
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="stations.csv"`)
+		if err := writeStationsCSV(w, detailedStations); err != nil {
+			requestLogger(r).Error("writing CSV failed", "err", err)
+		}
+	}))
+
+	// Handler for /stations/bbox - only the stations inside the map viewport, so the frontend can load markers as the user pans
+	http.HandleFunc("/stations/bbox", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		box, err := parseBoundingBox(r)
+		if err != nil {
+			writeError(w, err.Error(), 400)
+			return
+		}
+
+		stations, err := fetchAllStations(r.Context(), key)
+		if err != nil {
+			writeFetchError(w, r, err, "API fetch failed")
+			return
+		}
+		setCacheAge(w, staticFetchedAt())
+		writeJSON(w, r, stationsInBounds(stations, box))
 	}))
 
 	// Handler for /entrances
@@ -62,74 +335,572 @@ func registerHandlers(apiKey string) {
 		// so we filter the big array on the backend and only send relevant entrances.
 		// This saves bandwidth and keeps the frontend simple.
 		stationCode := r.URL.Query().Get("code")
-		if stationCode == "" {
+		// Optional ?lat=&lon=: sort by distance from that point ("which door do I use"),
+		// in which case the code is optional and leaving it out searches every entrance
+		byDistance := r.URL.Query().Has("lat") || r.URL.Query().Has("lon")
+		if stationCode == "" && !byDistance {
 			writeError(w, "Missing station code", 400)
 			return
 		}
+		var lat, lon float64
+		if byDistance {
+			var err error
+			if lat, lon, err = parseLatLon(r); err != nil {
+				writeError(w, err.Error(), 400)
+				return
+			}
+		}
 
 		// Ensure cache is populated
-		if _, err := fetchAllStations(apiKey); err != nil {
-			log.Println("ERROR /entrances:", err)
-			writeError(w, "Cache fetch failed", 500)
+		if _, err := fetchEntrances(r.Context(), key); err != nil {
+			writeFetchError(w, r, err, "Cache fetch failed")
+			return
+		}
+
+		// Look up entrances for this station code (index is built in refreshAllStations)
+		bundle := staticData()
+		stationEntrances := bundle.EntrancesByStation[stationCode]
+		if stationCode == "" {
+			stationEntrances = bundle.Entrances
+		}
+		if stationEntrances == nil {
+			stationEntrances = []StationEntrance{} // No entrances (or an unknown code) is [], not null
+		}
+
+		// Optional ?accessible=true: only entrances whose station elevators are all in service,
+		// each annotated with ElevatorsInService (joined against the outage data)
+		if r.URL.Query().Get("accessible") == "true" {
+			outages, err := fetchOutages(r.Context(), key)
+			if err != nil {
+				writeFetchError(w, r, err, "API fetch failed")
+				return
+			}
+			accessible := []AccessibleEntrance{}
+			for _, entrance := range annotateEntrances(stationEntrances, outages) {
+				if entrance.ElevatorsInService {
+					accessible = append(accessible, entrance)
+				}
+			}
+			if !byDistance {
+				writeJSON(w, r, accessible)
+				return
+			}
+			// Sorting by distance too: keep just the filtered entrances (they're all in service anyway)
+			stationEntrances = make([]StationEntrance, 0, len(accessible))
+			for _, entrance := range accessible {
+				stationEntrances = append(stationEntrances, entrance.StationEntrance)
+			}
+		}
+
+		if byDistance {
+			writeJSON(w, r, entrancesByDistance(stationEntrances, lat, lon))
 			return
 		}
+		writeJSON(w, r, stationEntrances)
+	}))
+
+	// Handler for /entrances/near - entrances within ?radius= meters (default 800) of ?lat=&lon=, closest first
+	http.HandleFunc("/entrances/near", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		lat, lon, err := parseLatLon(r)
+		if err != nil {
+			writeError(w, err.Error(), 400)
+			return
+		}
+
+		radius, err := parseRadius(r)
+		if err != nil {
+			writeError(w, err.Error(), 400)
+			return
+		}
+
+		entrances, err := fetchEntrancesNear(r.Context(), key, lat, lon, radius)
+		if err != nil {
+			writeFetchError(w, r, err, "API fetch failed")
+			return
+		}
+		writeJSON(w, r, entrancesByDistance(entrances, lat, lon))
+	}))
+
+	// Handler for /station - combined station page data for ?code= (info, entrances, parking, lines, predictions)
+	http.HandleFunc("/station", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		stationCode := r.URL.Query().Get("code")
+		if stationCode == "" {
+			writeError(w, "Missing station code", 400)
+			return
+		}
+
+		// Ensure every cache we read from is populated (each static dataset expires on its own)
+		_, err := fetchEntrances(r.Context(), key)
+		if err == nil {
+			_, err = fetchParking(r.Context(), key)
+		}
+		if err == nil {
+			_, err = fetchLines(r.Context(), key)
+		}
+		if err != nil {
+			writeFetchError(w, r, err, "Cache fetch failed")
+			return
+		}
+		predictions, err := fetchTrainPredictions(r.Context(), key)
+		if err != nil {
+			writeFetchError(w, r, err, "API fetch failed")
+			return
+		}
+
+		// Assemble all static data from one bundle, so it's a consistent snapshot
+		detail := StationDetail{Entrances: []StationEntrance{}, Lines: []Lines{}} // [] rather than null when a station has none
+		bundle := staticData()
+		station, found := findStation(bundle.Stations, stationCode)
+		if found {
+			detail.Station = station
+			detail.Entrances = append(detail.Entrances, bundle.EntrancesByStation[stationCode]...)
+			for i := range bundle.Parking {
+				if bundle.Parking[i].Code == stationCode {
+					parking := bundle.Parking[i] // Copy, so we don't hand out a pointer into the shared cache
+					detail.Parking = &parking
+					break
+				}
+			}
+			stationLineCodes := stationLines(station)
+			for _, line := range bundle.Lines {
+				for _, code := range stationLineCodes {
+					if line.LineCode == code {
+						detail.Lines = append(detail.Lines, line)
+					}
+				}
+			}
+		}
+
+		if !found {
+			writeError(w, "Unknown station code", 404)
+			return
+		}
+
+		detail.Predictions = sortPredictions(filterPredictionsByCode(predictions, []string{stationCode}))
+		writeJSON(w, r, detail)
+	}))
+
+	// Handler for /snapshot - stations, lines and predictions bundled into one response for initial page load
+	// Optional ?predictions=false leaves out the (large) predictions block when only static data is needed.
+	http.HandleFunc("/snapshot", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		includePredictions := r.URL.Query().Get("predictions") != "false"
 
-		// Filter entrances for this station code
-		cacheMutex.RLock()
-		var stationEntrances []StationEntrance
-		for _, entrance := range cachedEntrances {
-			if entrance.StationCode1 == stationCode || entrance.StationCode2 == stationCode {
-				stationEntrances = append(stationEntrances, entrance)
+		// Ensure caches are populated (fetchLines loads the stations too)
+		if _, err := fetchLines(r.Context(), key); err != nil {
+			writeFetchError(w, r, err, "Cache fetch failed")
+			return
+		}
+		if includePredictions {
+			if _, err := fetchTrainPredictions(r.Context(), key); err != nil {
+				writeFetchError(w, r, err, "API fetch failed")
+				return
 			}
 		}
-		cacheMutex.RUnlock()
 
-		writeJSON(w, stationEntrances)
+		// Stations and lines come from one static bundle, so they always match each other
+		var snapshot SnapshotResponse
+		bundle := staticData()
+		snapshot.Stations = bundle.Stations
+		snapshot.Lines = bundle.Lines
+		if includePredictions {
+			predictionMutex.RLock()
+			snapshot.Predictions, _ = predictionCache.Get(cacheKeyAll)
+			predictionMutex.RUnlock()
+			snapshot.Predictions = sortPredictions(snapshot.Predictions) // Always non-nil, so it's never omitted
+		}
+		writeJSON(w, r, snapshot)
 	}))
 
 	// Handler for /nexttrains
 	http.HandleFunc("/nexttrains", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
-		predictions, err := fetchTrainPredictions(key)
+		// Optional query param: ?code=A01 or ?code=A01,C01 (comma-separated for connected platforms).
+		// Without it, every prediction in the system is returned (backward compatible).
+		stationCodes := r.URL.Query().Get("code")
+		// Optional ?codes=A01,C01: like ?code=, but only those stations are fetched from WMATA
+		// (cached per station) instead of filtering the full "All" response. Cheaper for single-station pages.
+		onlyCodes := r.URL.Query().Get("codes")
+		if stationCodes != "" && onlyCodes != "" {
+			writeError(w, "code can't be combined with codes", 400)
+			return
+		}
+		// Optional ?line=RD or ?line=RD,BL, validated against the known line codes (see LineCode)
+		lineParam := r.URL.Query().Get("line")
+
+		// Optional ?merge=true: one entry per transfer complex (e.g. Metro Center A01 + C01), see mergePredictionsByStation
+		merge := r.URL.Query().Get("merge") == "true"
+		if merge && (r.URL.Query().Get("summary") == "true" || r.URL.Query().Get("grouped") == "true") {
+			writeError(w, "merge can't be combined with grouped or summary", 400)
+			return
+		}
+		// Optional ?board=true: rows per track like a station display, see boardPredictions (needs ?code=)
+		board := r.URL.Query().Get("board") == "true"
+		if board && (merge || r.URL.Query().Get("summary") == "true" || r.URL.Query().Get("grouped") == "true") {
+			writeError(w, "board can't be combined with merge, grouped or summary", 400)
+			return
+		}
+
+		var lineCodes []LineCode
+		if lineParam != "" {
+			var err error
+			if lineCodes, err = parseLineCodes(lineParam); err != nil {
+				writeError(w, err.Error(), 400)
+				return
+			}
+		}
+		limit, err := predictionLimit(r)
+		if err != nil {
+			writeError(w, err.Error(), 400)
+			return
+		}
+
+		// Under PREDICTION_STRATEGY=active, ?code= is served from the per-station cache like ?codes=
+		// (the background loop only keeps recently requested stations fresh, see activestations.go)
+		perStation := onlyCodes != "" || (stationCodes != "" && predictionStrategy == strategyActive)
+
+		var stations []StationInfo
+		if perStation || merge {
+			var err error
+			if stations, err = fetchAllStations(r.Context(), key); err != nil {
+				writeFetchError(w, r, err, "Cache fetch failed")
+				return
+			}
+		}
+
+		var predictions []TrainPrediction
+		var fetchedAt time.Time
+		if perStation {
+			// These codes end up in the WMATA URL, so check them against the station list first.
+			// An unknown ?codes= entry is a 400. Unknown ?code= entries are just dropped, since filtering
+			// the "All" response never returned anything for them either.
+			var codes []string
+			if onlyCodes != "" {
+				codes = strings.Split(onlyCodes, ",")
+				for i, code := range codes {
+					codes[i] = strings.TrimSpace(code)
+					if _, ok := findStation(stations, codes[i]); !ok {
+						writeError(w, "Unknown station code: "+codes[i], 400)
+						return
+					}
+				}
+			} else {
+				for _, code := range strings.Split(stationCodes, ",") {
+					if _, ok := findStation(stations, strings.TrimSpace(code)); ok {
+						codes = append(codes, strings.TrimSpace(code))
+					}
+				}
+			}
+			if merge {
+				codes = withPairedCodes(stations, codes) // The other platforms of each complex are merged in too
+			}
+			markStationsActive(codes)
+			var err error
+			if predictions, err = fetchPredictionsForStations(r.Context(), key, codes); err != nil {
+				writeFetchError(w, r, err, "API fetch failed")
+				return
+			}
+			fetchedAt = stationPredictionsFetchedAt(codes)
+			if stationCodes == "" {
+				stationCodes = onlyCodes // Already filtered, but lets ?summary= and ?grouped= below see a station was given
+			}
+		} else {
+			markAllStationsActive() // Someone wants the whole system, so the background loop should fetch "All"
+			var err error
+			if predictions, err = fetchTrainPredictions(r.Context(), key); err != nil {
+				writeFetchError(w, r, err, "API fetch failed")
+				return
+			}
+			fetchedAt = predictionsFetchedAt()
+
+			if stationCodes != "" {
+				codes := strings.Split(stationCodes, ",")
+				if merge {
+					codes = withPairedCodes(stations, codes)
+				}
+				predictions = filterPredictionsByCode(predictions, codes)
+			}
+		}
+		// Trains riders can't board are left out unless ?includeNonRevenue=true, see isNonRevenue
+		if r.URL.Query().Get("includeNonRevenue") != "true" {
+			predictions = filterRevenuePredictions(predictions)
+		}
+		if lineCodes != nil {
+			predictions = filterPredictionsByLine(predictions, lineCodes)
+		}
+		setCacheAge(w, fetchedAt)
+
+		if merge {
+			writeJSON(w, r, withEnvelope(r, mergePredictionsByStation(predictions, stations), fetchedAt))
+			return
+		}
+
+		// Optional ?summary=true: average train length per line at the station (needs ?code=)
+		if r.URL.Query().Get("summary") == "true" {
+			if stationCodes == "" {
+				writeError(w, "summary requires a station code", 400)
+				return
+			}
+			if r.URL.Query().Get("grouped") == "true" {
+				writeError(w, "summary can't be combined with grouped", 400)
+				return
+			}
+			writeJSON(w, r, withEnvelope(r, summarizeCars(predictions), fetchedAt))
+			return
+		}
+
+		if board {
+			if stationCodes == "" {
+				writeError(w, "board requires a station code", 400)
+				return
+			}
+			writeJSON(w, r, withEnvelope(r, boardPredictions(predictions), fetchedAt))
+			return
+		}
+
+		// Optional ?grouped=true: trains grouped by destination + track with headways (needs ?code=)
+		if r.URL.Query().Get("grouped") == "true" {
+			if stationCodes == "" {
+				writeError(w, "grouped requires a station code", 400)
+				return
+			}
+			writeJSON(w, r, withEnvelope(r, groupPredictions(predictions), fetchedAt))
+			return
+		}
+
+		// Optional ?limit=N: only the N soonest trains (capped by PREDICTION_LIMIT_MAX either way).
+		// X-Truncated has the full count whenever some were cut, so clients know there's more.
+		sorted := sortPredictions(predictions)
+		if limit > 0 && len(sorted) > limit {
+			w.Header().Set("X-Truncated", strconv.Itoa(len(sorted)))
+			sorted = sorted[:limit]
+		}
+		writeJSON(w, r, withEnvelope(r, sorted, fetchedAt))
+	}))
+
+	// Handler for /nexttrains/stream - pushes predictions over Server-Sent Events (SSE)
+	// The browser keeps one connection open (EventSource) and gets a message every time the
+	// prediction cache refreshes, instead of polling /nexttrains. Supports the same ?code= filter.
+	http.HandleFunc("/nexttrains/stream", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		// Flusher lets us push each message out immediately instead of waiting for the buffer to fill
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, "Streaming not supported", 500)
+			return
+		}
+		stationCodes := r.URL.Query().Get("code")
+		// The stream stays open indefinitely, so the server's timeouts (see server.go) can't apply to it
+		if err := clearConnDeadlines(w); err != nil {
+			requestLogger(r).Warn("could not clear connection deadlines", "err", err)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		// Subscribe BEFORE reading the current cache, so a refresh in between can't be missed
+		updates := predictionUpdates.Subscribe()
+		defer predictionUpdates.Unsubscribe(updates)
+
+		predictions, _ := predictionCache.Get(cacheKeyAll)
+
+		for {
+			if stationCodes != "" {
+				predictions = filterPredictionsByCode(predictions, strings.Split(stationCodes, ","))
+			}
+			if err := writeSSE(w, sortPredictions(predictions)); err != nil {
+				return // Client is gone
+			}
+			flusher.Flush()
+
+			// select waits on whichever channel is ready first (a bit like tokio::select! in Rust)
+			select {
+			case <-r.Context().Done(): // Client disconnected
+				return
+			case predictions = <-updates: // Cache refreshed (see broadcast.go)
+			}
+		}
+	}))
+
+	// Handler for /nexttrains/history - the last few refreshes' predictions, oldest first (optional ?code= filter)
+	http.HandleFunc("/nexttrains/history", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		var codes []string
+		if stationCodes := r.URL.Query().Get("code"); stationCodes != "" {
+			codes = strings.Split(stationCodes, ",")
+		}
+		markAllStationsActive() // History is only recorded by the "All" refresh, see activestations.go
+		writeJSON(w, r, predictionHistoryFor(codes))
+	}))
+
+	// Handler for /nexttrains/diff - trains added, removed or with a different Min between the last two refreshes
+	// Supports the same ?code= filter. For telling whether WMATA's own numbers are unstable or our caching is.
+	http.HandleFunc("/nexttrains/diff", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		var codes []string
+		if stationCodes := r.URL.Query().Get("code"); stationCodes != "" {
+			codes = strings.Split(stationCodes, ",")
+		}
+		markAllStationsActive() // Same as /nexttrains/history
+		snapshots := predictionHistoryFor(codes)
+		if len(snapshots) < 2 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(predictionRefreshInterval.Seconds()))))
+			writeError(w, "Not enough prediction history yet, try again after the next refresh", http.StatusServiceUnavailable)
+			return
+		}
+		before, after := snapshots[len(snapshots)-2], snapshots[len(snapshots)-1]
+		writeJSON(w, r, PredictionDiff{
+			From:    before.Time,
+			To:      after.Time,
+			Changes: diffPredictions(before.Predictions, after.Predictions),
+		})
+	}))
+
+	// Handler for /ws/predictions - live predictions over a WebSocket (see websocket.go)
+	http.HandleFunc("/ws/predictions", apiHandler(apiKey, handlePredictionsWebSocket))
+
+	// Handler for /nextbuses - next bus arrivals at ?stop= (a WMATA bus stop ID, e.g. 1001195)
+	http.HandleFunc("/nextbuses", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		stopID := r.URL.Query().Get("stop")
+		if stopID == "" {
+			writeError(w, "Missing stop ID", 400)
+			return
+		}
+
+		predictions, err := fetchBusPredictions(r.Context(), key, stopID)
 		if err != nil {
-			log.Println("ERROR /nexttrains:", err)
-			writeError(w, "API fetch failed", 500)
+			writeFetchError(w, r, err, "API fetch failed")
 			return
 		}
-		writeJSON(w, predictions)
+		writeJSON(w, r, predictions)
 	}))
 
-	// Handler for /lines
+	// Handler for /lines - every line, with its terminal station names added (StartStationName / EndStationName)
 	http.HandleFunc("/lines", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
-		if _, err := fetchAllStations(apiKey); err != nil {
-			log.Println("ERROR /lines:", err)
-			writeError(w, "Cache fetch failed", 500)
+		lines, err := fetchLines(r.Context(), key)
+		if err != nil {
+			writeFetchError(w, r, err, "Cache fetch failed")
+			return
+		}
+		stations, err := fetchAllStations(r.Context(), key)
+		if err != nil {
+			writeFetchError(w, r, err, "Cache fetch failed")
+			return
+		}
+		fetchedAt := staticData().LinesFetch.FetchedAt
+		setCacheAge(w, fetchedAt)
+		writeJSONCached(w, r, withEnvelope(r, linesWithTerminals(lines, stations), fetchedAt))
+	}))
+
+	// Handler for /search - stations whose name contains ?q= (any case), best matches first, for autocomplete
+	// The code counts too, so ?q=A01 finds Metro Center. Ranking and the result cap are in search.go.
+	http.HandleFunc("/search", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		if query == "" {
+			writeError(w, "Missing search query", 400)
 			return
 		}
-		cacheMutex.RLock()
-		lines := cachedLines
-		cacheMutex.RUnlock()
-		writeJSON(w, lines)
+		limit, err := searchLimit(r)
+		if err != nil {
+			writeError(w, err.Error(), 400)
+			return
+		}
+
+		if _, err := fetchAllStations(r.Context(), key); err != nil {
+			writeFetchError(w, r, err, "Cache fetch failed")
+			return
+		}
+		results := searchStations(staticData().Stations, query, limit)
+
+		writeJSON(w, r, results)
+	}))
+
+	// Handler for /lines/colors - the official colour of each line, from the table in lines.go (no WMATA call)
+	http.HandleFunc("/lines/colors", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		writeJSONCached(w, r, lineColors)
+	}))
+
+	// Handler for /lines/stations - every station on ?line= (any order, unlike /lines/{code}/stations)
+	// A plain index lookup, no jPath calls, so it's the quick way to highlight a whole line on the map.
+	http.HandleFunc("/lines/stations", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		lineParam := r.URL.Query().Get("line")
+		if lineParam == "" {
+			writeError(w, "Missing line code", 400)
+			return
+		}
+		lineCode, err := parseLineCode(lineParam)
+		if err != nil {
+			writeError(w, err.Error(), 400)
+			return
+		}
+
+		if _, err := fetchAllStations(r.Context(), key); err != nil {
+			writeFetchError(w, r, err, "Cache fetch failed")
+			return
+		}
+		lineStations := staticData().StationsByLine[string(lineCode)]
+
+		if lineStations == nil {
+			lineStations = []StationInfo{} // Valid code but no stations (e.g. "No"), send [] not null
+		}
+		writeJSONCached(w, r, lineStations)
+	}))
+
+	// Handler for /lines/{code}/stations - a line's stations in order (e.g. /lines/RD/stations)
+	// {code} is a path wildcard (Go 1.22+ ServeMux), read with r.PathValue.
+	http.HandleFunc("/lines/{code}/stations", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		lineCode, err := parseLineCode(r.PathValue("code"))
+		if err != nil {
+			writeError(w, err.Error(), 400)
+			return
+		}
+
+		stations, err := fetchAllStations(r.Context(), key)
+		if err != nil {
+			writeFetchError(w, r, err, "Cache fetch failed")
+			return
+		}
+		lines, err := fetchLines(r.Context(), key)
+		if err != nil {
+			writeFetchError(w, r, err, "Cache fetch failed")
+			return
+		}
+		line, found := findLine(lines, lineCode)
+		if !found {
+			writeError(w, "Unknown line code", 404)
+			return
+		}
+
+		ordered, err := lineStations(r.Context(), key, stations, line)
+		if err != nil {
+			writeFetchError(w, r, err, "API fetch failed")
+			return
+		}
+		writeJSONCached(w, r, ordered)
 	}))
 
 	// Handler for /parking
 	http.HandleFunc("/parking", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
 		stationCode := r.URL.Query().Get("code")
 
-		if _, err := fetchAllStations(apiKey); err != nil {
-			log.Println("ERROR /parking:", err)
-			writeError(w, "Cache fetch failed", 500)
+		parking, err := fetchParking(r.Context(), key)
+		if err != nil {
+			writeFetchError(w, r, err, "Cache fetch failed")
+			return
+		}
+		stations, err := fetchAllStations(r.Context(), key)
+		if err != nil {
+			writeFetchError(w, r, err, "Cache fetch failed")
 			return
 		}
+		fetchedAt := staticData().ParkingFetch.FetchedAt
+		setCacheAge(w, fetchedAt)
 
-		cacheMutex.RLock()
-		parking := cachedParking
-		cacheMutex.RUnlock()
+		// Optional ?hasParking=true: only stations with at least one space
+		hasParkingOnly := r.URL.Query().Get("hasParking") == "true"
+		enriched := parkingWithNames(parking, stations, hasParkingOnly)
 
 		// If a station code is provided, filter for that station
 		if stationCode != "" {
-			for _, p := range parking {
+			for _, p := range enriched {
 				if p.Code == stationCode {
-					writeJSON(w, p)
+					writeJSONCached(w, r, withEnvelope(r, p, fetchedAt))
 					return
 				}
 			}
@@ -139,16 +910,353 @@ func registerHandlers(apiKey string) {
 		}
 
 		// Otherwise, return all parking info
-		writeJSON(w, parking)
+		writeJSONCached(w, r, withEnvelope(r, enriched, fetchedAt))
+	}))
+
+	// Handler for /stationtimes - opening time and first/last trains for ?code=, for each day of the week
+	http.HandleFunc("/stationtimes", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		stationCode := r.URL.Query().Get("code")
+		if stationCode == "" {
+			writeError(w, "Missing station code", 400)
+			return
+		}
+
+		stationTimes, err := fetchStationTimes(r.Context(), key)
+		if err != nil {
+			writeFetchError(w, r, err, "Cache fetch failed")
+			return
+		}
+
+		for _, times := range stationTimes {
+			if times.Code == stationCode {
+				writeJSONCached(w, r, times)
+				return
+			}
+		}
+		writeError(w, "No station times for that station", 404)
+	}))
+
+	// Handler for /accessibility - outage counts and a step-free verdict for every station, the headline accessibility view
+	http.HandleFunc("/accessibility", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		stations, err := fetchAllStations(r.Context(), key)
+		if err != nil {
+			writeFetchError(w, r, err, "Cache fetch failed")
+			return
+		}
+		outages, err := fetchOutages(r.Context(), key)
+		if err != nil {
+			writeFetchError(w, r, err, "API fetch failed")
+			return
+		}
+		// Only used to count each station's elevators, without it every station is taken to have one
+		entrances, err := fetchEntrances(r.Context(), key)
+		if err != nil {
+			requestLogger(r).Warn("no entrance data, assuming one elevator per station", "err", err)
+		}
+		writeJSON(w, r, stationAccessibility(stations, entrances, outages))
+	}))
+
+	// Handler for /outages - elevator/escalator outages, optionally filtered with ?code=
+	http.HandleFunc("/outages", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		stationCode := r.URL.Query().Get("code")
+
+		outages, err := fetchOutages(r.Context(), key)
+		if err != nil {
+			writeFetchError(w, r, err, "API fetch failed")
+			return
+		}
+
+		// If a station code is provided, only return outages at that station
+		if stationCode != "" {
+			stationOutages := []ElevatorIncident{}
+			for _, outage := range outages {
+				if outage.StationCode == stationCode {
+					stationOutages = append(stationOutages, outage)
+				}
+			}
+			outages = stationOutages
+		}
+		writeJSON(w, r, outages)
+	}))
+
+	// Handler for /incidents - rail incidents, optionally filtered with ?line=RD
+	http.HandleFunc("/incidents", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		lineParam := r.URL.Query().Get("line")
+		var lineCode LineCode
+		if lineParam != "" {
+			var err error
+			if lineCode, err = parseLineCode(lineParam); err != nil {
+				writeError(w, err.Error(), 400)
+				return
+			}
+		}
+
+		incidents, err := fetchIncidents(r.Context(), key)
+		if err != nil {
+			writeFetchError(w, r, err, "API fetch failed")
+			return
+		}
+
+		if lineCode != "" {
+			lineIncidents := []Incident{}
+			for _, incident := range incidents {
+				if incidentAffectsLine(incident, lineCode) {
+					lineIncidents = append(lineIncidents, incident)
+				}
+			}
+			incidents = lineIncidents
+		}
+		writeJSON(w, r, incidents)
+	}))
+
+	// Handler for /nearest - the closest stations to ?lat=&lon=, optional ?limit= (default 5)
+	http.HandleFunc("/nearest", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		lat, lon, err := parseLatLon(r)
+		if err != nil {
+			writeError(w, err.Error(), 400)
+			return
+		}
+
+		limit := 5
+		if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+			limit, err = strconv.Atoi(limitParam)
+			if err != nil || limit < 1 {
+				writeError(w, "limit must be a positive integer", 400)
+				return
+			}
+		}
+
+		stations, err := fetchAllStations(r.Context(), key)
+		if err != nil {
+			writeFetchError(w, r, err, "API fetch failed")
+			return
+		}
+
+		nearby := stationsByDistance(stations, lat, lon)
+		if len(nearby) > limit {
+			nearby = nearby[:limit]
+		}
+		writeJSON(w, r, nearby)
+	}))
+
+	// Handler for /walkshed - every station within ?radius= meters (default 800, ~10 min walk) of ?lat=&lon=
+	http.HandleFunc("/walkshed", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		lat, lon, err := parseLatLon(r)
+		if err != nil {
+			writeError(w, err.Error(), 400)
+			return
+		}
+
+		radius, err := parseRadius(r)
+		if err != nil {
+			writeError(w, err.Error(), 400)
+			return
+		}
+
+		stations, err := fetchAllStations(r.Context(), key)
+		if err != nil {
+			writeFetchError(w, r, err, "API fetch failed")
+			return
+		}
+		writeJSON(w, r, stationsWithin(stations, lat, lon, radius))
 	}))
 
+	// Handler for /path - ordered stations between ?from= and ?to= (both on the same line)
+	http.HandleFunc("/path", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		fromCode, toCode, ok := parseStationPair(w, r, key)
+		if !ok {
+			return
+		}
+
+		path, err := fetchPath(r.Context(), key, fromCode, toCode)
+		if err != nil {
+			writeFetchError(w, r, err, "API fetch failed")
+			return
+		}
+		writeJSON(w, r, path)
+	}))
+
+	// Handler for /traveltime - rail time (minutes) and fares between ?from= and ?to=
+	http.HandleFunc("/traveltime", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		fromCode, toCode, ok := parseStationPair(w, r, key)
+		if !ok {
+			return
+		}
+
+		infos, err := fetchTravelTime(r.Context(), key, fromCode, toCode)
+		if err != nil {
+			writeFetchError(w, r, err, "API fetch failed")
+			return
+		}
+		if len(infos) == 0 {
+			writeError(w, "No travel time for that pair", 404)
+			return
+		}
+		writeJSONCached(w, r, infos[0])
+	}))
+
+	// Handler for /stats - how the latest refresh of each dataset went (duration, counts, errors), see stats.go
+	// Like /health it only reads state, and datasets that haven't refreshed yet are simply missing.
+	http.HandleFunc("/stats", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		writeJSON(w, r, refreshStatsSnapshot())
+	}))
+
+	// Handler for /health - reports cache freshness for monitoring / load balancers
+	// Doesn't trigger any fetches, it only reads the current cache state.
+	http.HandleFunc("/health", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		var health HealthResponse
+
+		bundle := staticData()
+		health.StaticCacheTime = bundle.StationsFetch.FetchedAt
+		health.CachedStations = len(bundle.Stations)
+		health.ExpectedStations = bundle.ExpectedStations
+		health.MissingStations = slices.Clone(bundle.MissingStations)
+		if health.MissingStations == nil {
+			health.MissingStations = []string{} // Not refreshed from WMATA yet (e.g. loaded from disk)
+		}
+		health.StaticChecksum = bundle.Checksum
+		health.Datasets = map[string]DatasetStatus{
+			"stations":     bundle.StationsFetch.status(),
+			"entrances":    bundle.EntrancesFetch.status(),
+			"lines":        bundle.LinesFetch.status(),
+			"parking":      bundle.ParkingFetch.status(),
+			"stationTimes": bundle.StationTimesFetch.status(),
+		}
+
+		predictionMutex.RLock()
+		health.PredictionCacheTime = predictionsFetchedAt()
+		predictions, _ := predictionCache.Get(cacheKeyAll)
+		health.CachedPredictions = len(predictions)
+		predictionMutex.RUnlock()
+
+		health.APIKeys = keyPoolFor(key).status()
+		health.RefreshFailures = refreshFailureCounts()
+		health.Warming.Static = staticWarming.Load()
+		health.Warming.Predictions = predictionsWarming.Load()
+
+		staticAge := time.Since(health.StaticCacheTime)
+		predictionAge := time.Since(health.PredictionCacheTime)
+		health.StaticCacheAgeSeconds = staticAge.Seconds()
+		health.PredictionCacheAgeSeconds = predictionAge.Seconds()
+		if predictionStrategy == strategyActive {
+			// The "All" cache is only refreshed while someone needs it, so judge the loop by its last run instead
+			predictionAge = time.Since(lastPredictionLoopRun())
+		}
+
+		// Warming = startup pre-warm still running, not ready for traffic yet
+		if health.Warming.Static || health.Warming.Predictions {
+			health.Status = "warming"
+			w.Header().Set("Retry-After", "5")
+			writeJSONStatus(w, r, health, http.StatusServiceUnavailable)
+			return
+		}
+
+		// Stale = a background loop has missed at least one refresh (older than 2x its interval)
+		if staticAge > 2*staticRefreshInterval || predictionAge > 2*predictionRefreshInterval {
+			health.Status = "stale"
+			writeJSONStatus(w, r, health, http.StatusServiceUnavailable)
+			return
+		}
+		health.Status = "ok"
+		writeJSON(w, r, health)
+	}))
+
+	// Handler for /admin/refresh - POST to refresh caches right now, e.g. after a known WMATA data correction
+	// ?target=stations, predictions or all (the default). Needs "Authorization: Bearer <ADMIN_TOKEN>".
+	http.HandleFunc("/admin/refresh", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, "Method not allowed", 405)
+			return
+		}
+		if !checkAdminToken(r) {
+			writeError(w, "Unauthorized", 401)
+			return
+		}
+
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			target = "all"
+		}
+		if target != "stations" && target != "predictions" && target != "all" {
+			writeError(w, "target must be stations, predictions or all", 400)
+			return
+		}
+
+		if target == "stations" || target == "all" {
+			if _, err := forceRefreshAllStations(r.Context(), key); err != nil {
+				writeFetchError(w, r, err, "Station refresh failed")
+				return
+			}
+		}
+		if target == "predictions" || target == "all" {
+			if _, err := refreshTrainPredictions(r.Context(), key); err != nil {
+				writeFetchError(w, r, err, "Prediction refresh failed")
+				return
+			}
+		}
+		requestLogger(r).Info("caches refreshed by admin", "target", target)
+
+		writeJSON(w, r, AdminRefreshResponse{
+			Target:              target,
+			StaticCacheTime:     staticFetchedAt(),
+			PredictionCacheTime: predictionsFetchedAt(),
+		})
+	}))
+
+	// Handler for /metrics - Prometheus scrape endpoint (metrics are defined in metrics.go)
+	// Registered directly instead of through apiHandler so scrapes don't flood the request log.
+	http.Handle("/metrics", promhttp.Handler())
+
 	// Handler for /geojson/stations - serves static GeoJSON file for station info
+	// Optional ?live=true builds the GeoJSON from the station cache instead, so it always matches WMATA's data
 	http.HandleFunc("/geojson/stations", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
-		http.ServeFile(w, r, "Metro_Rail_Stations.geojson")
+		if r.URL.Query().Get("live") == "true" {
+			// If there are no live stations (WMATA down at startup and no disk cache), fall back to the
+			// bundled file below rather than sending an empty FeatureCollection, so the map still has stations
+			stations, err := fetchAllStations(r.Context(), key)
+			if err == nil && len(stations) > 0 {
+				requestLogger(r).Debug("serving station GeoJSON", "source", "live", "stations", len(stations))
+				writeGeoJSON(w, stationsGeoJSON(stations))
+				return
+			}
+			requestLogger(r).Warn("no live station data, serving station GeoJSON", "source", "static_file", "err", err)
+			// Not serveGeoJSONFile: the browser shouldn't hold on to the fallback for a day once WMATA is back
+			if !geojsonFileUsable(w, stationsGeoJSONFile) {
+				return
+			}
+			w.Header().Set("Cache-Control", "no-cache")
+			http.ServeFile(w, r, stationsGeoJSONFile)
+			return
+		}
+		serveGeoJSONFile(w, r, stationsGeoJSONFile)
 	}))
 
 	// Handler for /geojson/lines - serves static GeoJSON file for rail lines
+	// Optional ?live=true builds the lines from the station order instead (see linesGeoJSON), like /geojson/stations
 	http.HandleFunc("/geojson/lines", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
-		http.ServeFile(w, r, "Metro_Rail_Lines.geojson")
+		if r.URL.Query().Get("live") == "true" {
+			collection, err := liveLinesGeoJSON(r.Context(), key)
+			if err == nil && len(collection.Features) > 0 {
+				requestLogger(r).Debug("serving line GeoJSON", "source", "live", "lines", len(collection.Features))
+				writeGeoJSON(w, collection)
+				return
+			}
+			// Same fallback as /geojson/stations: the bundled file beats no lines on the map
+			requestLogger(r).Warn("no live line data, serving line GeoJSON", "source", "static_file", "err", err)
+			if !geojsonFileUsable(w, linesGeoJSONFile) {
+				return
+			}
+			w.Header().Set("Cache-Control", "no-cache")
+			http.ServeFile(w, r, linesGeoJSONFile)
+			return
+		}
+		serveGeoJSONFile(w, r, linesGeoJSONFile)
+	}))
+
+	// Handler for /openapi.json - OpenAPI 3 description of the main endpoints, for Swagger UI and client generators
+	// Hand-maintained alongside types.go, so update it when a response struct or query param changes.
+	http.HandleFunc("/openapi.json", apiHandler(apiKey, func(w http.ResponseWriter, r *http.Request, key string) {
+		http.ServeFile(w, r, "openapi.json")
 	}))
 }
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// End-to-end handler tests: the real handlers (registered on http.DefaultServeMux) backed by the fake WMATA
+// from cache_test.go, checking what a client gets back.
+
+var registerOnce sync.Once
+
+// serve sends a GET through the registered handlers
+func serve(path string) *httptest.ResponseRecorder {
+	registerOnce.Do(func() { registerHandlers(testAPIKey) }) // Registering twice would panic
+	rec := httptest.NewRecorder()
+	http.DefaultServeMux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+// getJSON is serve for a request that has to succeed, decoding the JSON reply into target
+func getJSON(t *testing.T, path string, target interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := serve(path)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d, body %s", path, rec.Code, rec.Body.String())
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), target); err != nil {
+		t.Fatalf("GET %s: decoding %q: %v", path, rec.Body.String(), err)
+	}
+	return rec
+}
+
+// readFixtureJSON decodes one of the files in fixtures/
+func readFixtureJSON(t *testing.T, name string, target interface{}) {
+	t.Helper()
+	data, err := readFixture(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, target); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+}
+
+func TestStationsHandler(t *testing.T) {
+	startFakeWMATA(t, fixtureWMATA(t))
+
+	var want StationsResponse
+	readFixtureJSON(t, "stations.json", &want)
+
+	var stations []StationInfo
+	rec := getJSON(t, "/stations", &stations)
+	if len(stations) != len(want.Stations) {
+		t.Fatalf("got %d stations, want %d", len(stations), len(want.Stations))
+	}
+	for i, station := range stations {
+		if station.Code != want.Stations[i].Code || station.Name != want.Stations[i].Name {
+			t.Errorf("station %d = %s %q, want %s %q", i, station.Code, station.Name, want.Stations[i].Code, want.Stations[i].Name)
+		}
+	}
+	if rec.Header().Get("X-Partial-Data") != "" {
+		t.Errorf("X-Partial-Data = %q on a complete list", rec.Header().Get("X-Partial-Data"))
+	}
+}
+
+func TestLinesHandler(t *testing.T) {
+	startFakeWMATA(t, fixtureWMATA(t))
+
+	var want LinesResponse
+	readFixtureJSON(t, "lines.json", &want)
+
+	var lines []LineWithTerminals
+	getJSON(t, "/lines", &lines)
+	if len(lines) != len(want.Lines) {
+		t.Fatalf("got %d lines, want %d", len(lines), len(want.Lines))
+	}
+	for _, line := range lines {
+		if line.ColorHex == "" || line.ColorHex != lineColorHex(LineCode(line.LineCode)) {
+			t.Errorf("line %s: ColorHex = %q", line.LineCode, line.ColorHex)
+		}
+	}
+	if lines[0].LineCode != want.Lines[0].LineCode || lines[0].DisplayName != want.Lines[0].DisplayName {
+		t.Errorf("first line = %s %q, want %s %q", lines[0].LineCode, lines[0].DisplayName, want.Lines[0].LineCode, want.Lines[0].DisplayName)
+	}
+}
+
+func TestNextTrainsHandler(t *testing.T) {
+	startFakeWMATA(t, fixtureWMATA(t))
+
+	var fixture TrainPredictionsResponse
+	readFixtureJSON(t, "predictions.json", &fixture)
+	revenue := 0
+	for _, p := range fixture.Trains {
+		if !isNonRevenue(p) {
+			revenue++
+		}
+	}
+
+	var trains []TrainPrediction
+	getJSON(t, "/nexttrains", &trains)
+	if len(trains) != revenue {
+		t.Fatalf("got %d trains, want the %d revenue trains", len(trains), revenue)
+	}
+	for i, train := range trains {
+		if train.Status == "" {
+			t.Errorf("train %d has no Status, enrichPrediction didn't run", i)
+		}
+		if i > 0 && comparePredictions(trains[i-1], train) > 0 {
+			t.Errorf("trains %d and %d out of order: %q then %q", i-1, i, trains[i-1].Min, train.Min)
+		}
+	}
+
+	// ?code= only returns that platform's trains
+	var atMetroCenter []TrainPrediction
+	getJSON(t, "/nexttrains?code=A01", &atMetroCenter)
+	if len(atMetroCenter) == 0 {
+		t.Fatal("no trains for A01 in the fixture")
+	}
+	for _, train := range atMetroCenter {
+		if train.LocationCode != "A01" {
+			t.Errorf("?code=A01 returned a train at %s", train.LocationCode)
+		}
+	}
+}
+
+func TestEmptyListsEncodeAsArrays(t *testing.T) {
+	startFakeWMATA(t, fixtureWMATA(t))
+
+	// Each of these has nothing to list, which has to come back as [] rather than null
+	for _, path := range []string{
+		"/nexttrains?code=ZZZ",
+		"/nexttrains?code=ZZZ&grouped=true",
+		"/nexttrains?code=ZZZ&board=true",
+	} {
+		var raw json.RawMessage
+		getJSON(t, path, &raw)
+		if string(raw) != "[]" {
+			t.Errorf("GET %s = %s, want []", path, raw)
+		}
+	}
+
+	// Shady Grove has no entrances in the fixtures
+	var detail map[string]json.RawMessage
+	getJSON(t, "/station?code=A15", &detail)
+	for _, field := range []string{"Entrances", "Lines", "Predictions"} {
+		if value := string(detail[field]); value == "null" || value == "" {
+			t.Errorf("/station?code=A15: %s = %q, want a list", field, value)
+		}
+	}
+}
+
+func TestStationPairValidation(t *testing.T) {
+	startFakeWMATA(t, fixtureWMATA(t))
+
+	// All refused before any jPath / jSrcStationToDstStationInfo call
+	for _, endpoint := range []string{"/path", "/traveltime"} {
+		for _, query := range []string{"", "?from=A01", "?to=A03", "?from=A01&to=A01", "?from=A01&to=ZZZ", "?from=ZZZ&to=A01"} {
+			if rec := serve(endpoint + query); rec.Code != http.StatusBadRequest {
+				t.Errorf("GET %s%s: status %d (%s), want 400", endpoint, query, rec.Code, rec.Body.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// In-memory history of recent prediction snapshots (/nexttrains/history), so the frontend can spot
+// trains that have been stuck on "ARR" or the same minute count for several refreshes.
+
+var (
+	predictionHistorySize = 30 // Snapshots kept (30 x 20s refresh = 10 minutes), overridable via PREDICTION_HISTORY_SIZE
+	predictionHistory     = newRingBuffer[PredictionSnapshot](predictionHistorySize)
+)
+
+// ringBuffer keeps the last N values pushed into it, overwriting the oldest once full
+type ringBuffer[T any] struct {
+	mu    sync.RWMutex
+	items []T
+	next  int  // Index the next Push writes to
+	full  bool // True once we've wrapped around at least once
+}
+
+func newRingBuffer[T any](size int) *ringBuffer[T] {
+	if size < 1 {
+		size = 1
+	}
+	return &ringBuffer[T]{items: make([]T, size)}
+}
+
+// Push adds a value, dropping the oldest one if the buffer is full
+func (b *ringBuffer[T]) Push(value T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.items[b.next] = value
+	b.next = (b.next + 1) % len(b.items)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Items returns a copy of the buffered values, oldest first
+func (b *ringBuffer[T]) Items() []T {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if !b.full {
+		return append([]T{}, b.items[:b.next]...)
+	}
+	// Wrapped: the oldest value is at next, so read next..end then start..next
+	return append(append([]T{}, b.items[b.next:]...), b.items[:b.next]...)
+}
+
+// recordPredictionSnapshot stores a refresh in the history buffer
+func recordPredictionSnapshot(at time.Time, predictions []TrainPrediction) {
+	predictionHistory.Push(PredictionSnapshot{Time: at, Predictions: predictions})
+}
+
+// predictionHistoryFor returns the history, oldest first, filtered to station codes when given
+func predictionHistoryFor(codes []string) []PredictionSnapshot {
+	snapshots := predictionHistory.Items()
+	if codes == nil {
+		return snapshots
+	}
+	for i := range snapshots {
+		snapshots[i].Predictions = filterPredictionsByCode(snapshots[i].Predictions, codes) // Items() gave us copies
+	}
+	return snapshots
+}
+
+// diffPredictions compares two snapshots' trains (/nexttrains/diff)
+// WMATA gives trains no ID, so a train is matched by where it is and where it's going (LocationCode, Group,
+// Line, DestinationCode) plus its position among those, soonest first: the 2nd train to Glenmont from A01
+// track 1 before is compared with the 2nd one now. Good enough to see whether WMATA's numbers jump around.
+func diffPredictions(before, after []TrainPrediction) []PredictionChange {
+	type entry struct {
+		train TrainPrediction
+		key   string
+	}
+	keyed := func(predictions []TrainPrediction) ([]entry, map[string]TrainPrediction) {
+		var entries []entry
+		byKey := make(map[string]TrainPrediction, len(predictions))
+		seen := make(map[string]int)
+		for _, p := range sortPredictions(predictions) {
+			base := p.LocationCode + "|" + p.Group + "|" + p.Line + "|" + p.DestinationCode
+			seen[base]++
+			key := fmt.Sprintf("%s|%d", base, seen[base])
+			entries = append(entries, entry{train: p, key: key})
+			byKey[key] = p
+		}
+		return entries, byKey
+	}
+	beforeEntries, beforeByKey := keyed(before)
+	afterEntries, afterByKey := keyed(after)
+
+	changes := []PredictionChange{} // Non-nil so "nothing changed" encodes as []
+	for _, e := range afterEntries {
+		old, ok := beforeByKey[e.key]
+		switch {
+		case !ok:
+			changes = append(changes, newPredictionChange("added", e.train, "", e.train.Min))
+		case old.Min != e.train.Min:
+			changes = append(changes, newPredictionChange("changed", e.train, old.Min, e.train.Min))
+		}
+	}
+	for _, e := range beforeEntries {
+		if _, ok := afterByKey[e.key]; !ok {
+			changes = append(changes, newPredictionChange("removed", e.train, e.train.Min, ""))
+		}
+	}
+	return changes
+}
+
+// newPredictionChange fills in a PredictionChange for one train
+func newPredictionChange(change string, p TrainPrediction, oldMin, newMin string) PredictionChange {
+	return PredictionChange{
+		Change:          change,
+		LocationCode:    p.LocationCode,
+		Group:           p.Group,
+		Line:            p.Line,
+		DestinationCode: p.DestinationCode,
+		DestinationName: p.DestinationName,
+		OldMin:          oldMin,
+		NewMin:          newMin,
+	}
+}
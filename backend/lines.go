@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// Helpers for line-level views (ordered station lists)
+
+var (
+	// Ordered stations per line never change (same as paths), so they're cached forever
+	cachedLineStations = make(map[string]LineStations) // Keyed by line code
+	lineStationsMutex  sync.RWMutex
+)
+
+// findLine looks up a line by code
+func findLine(lines []Lines, code LineCode) (Lines, bool) {
+	for _, line := range lines {
+		if LineCode(line.LineCode) == code {
+			return line, true
+		}
+	}
+	return Lines{}, false
+}
+
+// LineCode is a WMATA line abbreviation. A named string type (like a newtype in Rust) so the valid
+// values are listed in one place and a typo'd code gets caught by parseLineCode instead of silently matching nothing.
+type LineCode string
+
+const (
+	LineRed    LineCode = "RD"
+	LineBlue   LineCode = "BL"
+	LineOrange LineCode = "OR"
+	LineSilver LineCode = "SV"
+	LineGreen  LineCode = "GR"
+	LineYellow LineCode = "YL"
+	// The rare ones: WMATA uses "No" for trains not carrying passengers, and "YLRP" was the old
+	// Yellow Line Rush Plus service, which can still show up in older data
+	LineNoPassengers   LineCode = "No"
+	LineYellowRushPlus LineCode = "YLRP"
+)
+
+// rareLineCodes are the known codes without a passenger line colour, see lineColors
+var rareLineCodes = []LineCode{LineNoPassengers, LineYellowRushPlus}
+
+// validLineCodes is every code parseLineCode accepts, in a fixed order (lineColors' lines, then the rare ones),
+// so its error message lists them the same way every time and can't drift from what's actually accepted
+var validLineCodes = func() []LineCode {
+	codes := make([]LineCode, 0, len(lineColors)+len(rareLineCodes))
+	for _, color := range lineColors {
+		codes = append(codes, LineCode(color.LineCode))
+	}
+	return append(codes, rareLineCodes...)
+}()
+
+// lineColors is WMATA's official name and colour for each passenger line (/lines/colors, and ColorHex on /lines)
+// WMATA's API doesn't publish colours, so they live here instead of being hardcoded in every client.
+// A slice rather than a map so /lines/colors always lists them in the same order.
+var lineColors = []LineColor{
+	{LineCode: string(LineRed), Name: "Red", ColorHex: "#BF0D3E"},
+	{LineCode: string(LineBlue), Name: "Blue", ColorHex: "#009CDE"},
+	{LineCode: string(LineOrange), Name: "Orange", ColorHex: "#ED8B00"},
+	{LineCode: string(LineSilver), Name: "Silver", ColorHex: "#919D9D"},
+	{LineCode: string(LineGreen), Name: "Green", ColorHex: "#00B140"},
+	{LineCode: string(LineYellow), Name: "Yellow", ColorHex: "#FFD100"},
+}
+
+// lineColorHex returns a line's official colour, or "" for codes without one ("No", "YLRP")
+func lineColorHex(code LineCode) string {
+	for _, color := range lineColors {
+		if LineCode(color.LineCode) == code {
+			return color.ColorHex
+		}
+	}
+	return ""
+}
+
+// linesWithTerminals adds the start/end station names and line colour to each line, saving the frontend a join
+// against /stations. A terminal missing from the station list just gets an empty name.
+func linesWithTerminals(lines []Lines, stations []StationInfo) []LineWithTerminals {
+	names := make(map[string]string, len(stations))
+	for _, station := range stations {
+		names[station.Code] = station.Name
+	}
+
+	enriched := make([]LineWithTerminals, 0, len(lines))
+	for _, line := range lines {
+		enriched = append(enriched, LineWithTerminals{
+			Lines:            line,
+			StartStationName: names[line.StartStationCode],
+			EndStationName:   names[line.EndStationCode],
+			ColorHex:         lineColorHex(LineCode(line.LineCode)),
+		})
+	}
+	return enriched
+}
+
+// parseLineCode validates a single line code, accepting any case ("rd" -> RD, "no" -> No)
+func parseLineCode(raw string) (LineCode, error) {
+	raw = strings.TrimSpace(raw)
+	for _, code := range validLineCodes {
+		if strings.EqualFold(raw, string(code)) {
+			return code, nil
+		}
+	}
+	valid := make([]string, len(validLineCodes))
+	for i, code := range validLineCodes {
+		valid[i] = string(code)
+	}
+	return "", fmt.Errorf("unknown line code: %q (valid: %s)", raw, strings.Join(valid, ", "))
+}
+
+// parseLineCodes validates a comma-separated list like "RD,BL", returning an error naming the first bad one
+func parseLineCodes(raw string) ([]LineCode, error) {
+	parts := strings.Split(raw, ",")
+	codes := make([]LineCode, 0, len(parts))
+	for _, part := range parts {
+		code, err := parseLineCode(part)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// orderedStationsBetween turns a jPath result into full StationInfo entries, in path order
+// Also returns how many path stations weren't in the station list and had to be left out.
+func orderedStationsBetween(ctx context.Context, apiKey string, stations []StationInfo, fromCode string, toCode string) ([]StationInfo, int, error) {
+	path, err := fetchPath(ctx, apiKey, fromCode, toCode)
+	if err != nil {
+		return nil, 0, err
+	}
+	skipped := 0
+
+	ordered := make([]StationInfo, 0, len(path))
+	for _, item := range path {
+		station, ok := findStation(stations, item.StationCode)
+		if !ok {
+			slog.Warn("path station missing from station cache", "station", item.StationCode)
+			skipped++
+			continue
+		}
+		ordered = append(ordered, station)
+	}
+	return ordered, skipped, nil
+}
+
+// lineStations returns the ordered stations for a line, terminal to terminal (/lines/{code}/stations)
+// Lines with an InternalDestination that isn't on the main run (a branch) get that run listed in Branches.
+// A list with stations left out (the station cache was incomplete) is returned but not cached, so it gets
+// rebuilt once the station list is whole again instead of staying short until a restart.
+func lineStations(ctx context.Context, apiKey string, stations []StationInfo, line Lines) (LineStations, error) {
+	lineStationsMutex.RLock()
+	cached, ok := cachedLineStations[line.LineCode]
+	lineStationsMutex.RUnlock()
+	if ok {
+		return cached, nil
+	}
+
+	result := LineStations{LineCode: line.LineCode, DisplayName: line.DisplayName}
+	mainRun, skipped, err := orderedStationsBetween(ctx, apiKey, stations, line.StartStationCode, line.EndStationCode)
+	if err != nil {
+		return LineStations{}, err
+	}
+	result.Stations = mainRun
+
+	onMainRun := make(map[string]bool, len(mainRun))
+	for _, station := range mainRun {
+		onMainRun[station.Code] = true
+	}
+	for _, destination := range []string{line.InternalDestination1, line.InternalDestination2} {
+		if destination == "" || onMainRun[destination] {
+			continue
+		}
+		branch, branchSkipped, err := orderedStationsBetween(ctx, apiKey, stations, line.StartStationCode, destination)
+		if err != nil {
+			return LineStations{}, err
+		}
+		skipped += branchSkipped
+		result.Branches = append(result.Branches, LineBranch{ToStationCode: destination, Stations: branch})
+	}
+
+	if skipped > 0 {
+		return result, nil
+	}
+	lineStationsMutex.Lock()
+	cachedLineStations[line.LineCode] = result
+	lineStationsMutex.Unlock()
+
+	return result, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLineStationsNotCachedWhenIncomplete(t *testing.T) {
+	startFakeWMATA(t, fixtureWMATA(t))
+
+	// jPath has no fixture, so the path goes straight into the path cache
+	cachedPaths.Add("A01|A03", []PathItem{
+		{LineCode: "RD", StationCode: "A01", SeqNum: 1},
+		{LineCode: "RD", StationCode: "A02", SeqNum: 2},
+		{LineCode: "RD", StationCode: "A03", SeqNum: 3},
+	})
+	line := Lines{LineCode: "RD", DisplayName: "Red", StartStationCode: "A01", EndStationCode: "A03"}
+
+	// A02 is missing from this (partial) station list
+	partial := []StationInfo{{Code: "A01"}, {Code: "A03"}}
+	result, err := lineStations(context.Background(), testAPIKey, partial, line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Stations) != 2 {
+		t.Errorf("got %d stations from the partial list, want 2", len(result.Stations))
+	}
+	lineStationsMutex.RLock()
+	_, cached := cachedLineStations["RD"]
+	lineStationsMutex.RUnlock()
+	if cached {
+		t.Fatal("a list with a station left out was cached")
+	}
+
+	// Once the station list is whole, the full line is built and cached
+	complete := []StationInfo{{Code: "A01"}, {Code: "A02"}, {Code: "A03"}}
+	if result, err = lineStations(context.Background(), testAPIKey, complete, line); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Stations) != 3 {
+		t.Errorf("got %d stations from the complete list, want 3", len(result.Stations))
+	}
+	lineStationsMutex.RLock()
+	_, cached = cachedLineStations["RD"]
+	lineStationsMutex.RUnlock()
+	if !cached {
+		t.Error("the complete list wasn't cached")
+	}
+}
+
+func TestParseLineCode(t *testing.T) {
+	for raw, want := range map[string]LineCode{"RD": LineRed, "rd": LineRed, " bl ": LineBlue, "no": LineNoPassengers, "YLRP": LineYellowRushPlus} {
+		if got, err := parseLineCode(raw); err != nil || got != want {
+			t.Errorf("parseLineCode(%q) = %q, %v, want %q", raw, got, err, want)
+		}
+	}
+
+	_, err := parseLineCode("PK")
+	if err == nil {
+		t.Fatal("parseLineCode(PK) accepted it")
+	}
+	if want := `unknown line code: "PK" (valid: RD, BL, OR, SV, GR, YL, No, YLRP)`; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+}
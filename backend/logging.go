@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Structured logging with log/slog (Go's built-in structured logger).
+// Every line is a JSON object like {"time":...,"level":"INFO","msg":...,"request_id":...}
+// so log aggregation tools can filter on fields instead of regex-parsing printf strings.
+
+// contextKey is a private type for context values, so no other package can collide with our keys
+type contextKey string
+
+const loggerKey contextKey = "logger"
+
+// logLevel is the minimum level that gets logged. A LevelVar can be changed after the logger is built,
+// which matters because LOG_LEVEL may come from .env, and that's only loaded after setupLogger runs.
+var logLevel slog.LevelVar // Zero value = Info
+
+// setupLogger makes slog's JSON handler the default for slog.* AND the old log.* functions
+func setupLogger() {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: &logLevel}))
+	slog.SetDefault(logger)
+}
+
+// setLogLevel sets the minimum log level from a name: debug, info, warn or error (any case)
+// Per-refresh timing lines are Debug, so the default (info) keeps production logs to requests, warnings and errors.
+func setLogLevel(name string) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		slog.Warn("invalid log level, using default", "var", "LOG_LEVEL", "value", name, "default", logLevel.Level().String())
+		return
+	}
+	logLevel.Set(level)
+}
+
+// newRequestID returns a short random hex ID used to tie together all log lines for one request
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestLogger returns the logger attached to this request by apiHandler (with request_id, method, path)
+// Falls back to the default logger if called outside apiHandler.
+func requestLogger(r *http.Request) *slog.Logger {
+	if logger, ok := r.Context().Value(loggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// withRequestLogger returns a copy of the request carrying a request-scoped logger
+func withRequestLogger(r *http.Request, logger *slog.Logger) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), loggerKey, logger))
+}
+
+// statusRecorder wraps http.ResponseWriter so we can see which status code the handler sent
+// (http.ResponseWriter has no getter for it). Embedding means all other methods pass straight through.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool // The response has started, so the status can't change (see recoverPanic)
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.wroteHeader = true
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Write marks the response as started too, since a Write without WriteHeader sends an implicit 200
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	return rec.ResponseWriter.Write(b)
+}
+
+// Flush passes through to the real writer, needed by the SSE stream handler
+func (rec *statusRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack passes through to the real writer, needed to upgrade /ws/predictions to a WebSocket
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking not supported")
+	}
+	rec.status = http.StatusSwitchingProtocols
+	rec.wroteHeader = true
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// logRequest writes the one summary line per request (method, path, status, duration)
+func logRequest(logger *slog.Logger, rec *statusRecorder, start time.Time) {
+	logger.Info("request",
+		"status", rec.status,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+}
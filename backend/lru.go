@@ -0,0 +1,73 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lruCache is a small fixed-size, concurrency-safe LRU (least recently used) cache.
+// When it's full, adding a new key evicts whichever key was used longest ago.
+// Generic over key and value types, like HashMap<K, V> in Rust.
+type lruCache[K comparable, V any] struct {
+	mu       sync.Mutex // Plain Mutex (not RWMutex): even Get updates the recency order
+	capacity int
+	order    *list.List          // Front = most recently used
+	items    map[K]*list.Element // Points into order for O(1) lookups
+}
+
+// lruEntry is what each list element holds
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// newLRUCache creates an LRU cache holding at most capacity entries (minimum 1)
+func newLRUCache[K comparable, V any](capacity int) *lruCache[K, V] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &lruCache[K, V]{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[K]*list.Element),
+	}
+}
+
+// Get returns the value for key and marks it as recently used
+func (c *lruCache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.order.MoveToFront(elem)
+		return elem.Value.(*lruEntry[K, V]).value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Add inserts or updates key, evicting the least recently used entry if the cache is full
+func (c *lruCache[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*lruEntry[K, V]).value = value
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&lruEntry[K, V]{key: key, value: value})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry[K, V]).key)
+	}
+}
+
+// Len returns the number of cached entries
+func (c *lruCache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
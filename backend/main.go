@@ -1,55 +1,231 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
-	"net/http"
+	"io/fs"
+	"log/slog"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
 func main() {
+	// JSON structured logs (see logging.go), set up first so every log line uses it
+	setupLogger()
+
 	// Load .env file
 	// Declares err AND checks it on one line. godotenv.Load() only returns error or nil if success.
-	if err := godotenv.Load(); err != nil {
-		log.Fatal("Error loading .env file")
+	// A missing file is fine: DATA_SOURCE=fixtures needs no key, and live mode stops at validateAPIKey anyway.
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Error("Error loading .env file", "err", err)
+		os.Exit(1)
 	}
 
 	apiKey := os.Getenv("WMATA_API_KEY")
-	fmt.Println("==== Server running on :8080 ====")
-	fmt.Println("Frontend: http://localhost:8080")
-	fmt.Println("API: http://localhost:8080/stations")
 
-	// Pre-warm caches sequentially on startup to avoid rate limiting
-	log.Println("Pre-warming caches...")
-	if _, err := refreshAllStations(apiKey); err != nil {
-		log.Println("ERROR: Failed to pre-warm static cache:", err)
+	// Optional overrides, defaults are used when unset or invalid
+	setLogLevel(getEnv("LOG_LEVEL", "info"))
+	port := getEnv("PORT", "8080")
+	predictionRefreshInterval = getEnvDuration("PREDICTION_REFRESH_INTERVAL", predictionRefreshInterval)
+	staticRefreshInterval = getEnvDuration("STATIC_REFRESH_INTERVAL", staticRefreshInterval)
+	refreshJitter = getEnvFloat("REFRESH_JITTER", refreshJitter)
+	staticCacheFile = getEnv("STATIC_CACHE_FILE", staticCacheFile)
+	wmataBaseURL = strings.TrimSuffix(getEnv("WMATA_BASE_URL", wmataBaseURL), "/")
+	if timeout := getEnvDuration("WMATA_TIMEOUT", wmataRequestTimeout); timeout != wmataRequestTimeout {
+		wmataRequestTimeout = timeout
+		wmataClient = newWMATAClient(wmataRequestTimeout)
+	}
+	// 0 would mean no workers at all, so unlike most counts it has to be at least 1
+	if n := getEnvInt("STATION_FETCH_CONCURRENCY", stationFetchConcurrency); n < 1 {
+		slog.Warn("invalid integer, using default", "var", "STATION_FETCH_CONCURRENCY", "value", n, "default", stationFetchConcurrency)
+	} else if n != stationFetchConcurrency {
+		stationFetchConcurrency = n
+		wmataClient = newWMATAClient(wmataRequestTimeout) // Its idle connection pool is sized from this
+	}
+	serverReadTimeout = getEnvDuration("SERVER_READ_TIMEOUT", serverReadTimeout)
+	serverWriteTimeout = getEnvDuration("SERVER_WRITE_TIMEOUT", serverWriteTimeout)
+	serverIdleTimeout = getEnvDuration("SERVER_IDLE_TIMEOUT", serverIdleTimeout)
+	strictJSON = os.Getenv("WMATA_STRICT_JSON") == "true"
+	adminToken = os.Getenv("ADMIN_TOKEN")
+	switch source := getEnv("DATA_SOURCE", dataSource); source {
+	case dataSourceLive, dataSourceFixtures:
+		dataSource = source
+	default:
+		slog.Warn("invalid data source, using default", "var", "DATA_SOURCE", "value", source, "default", dataSource)
+	}
+	fixturesDir = getEnv("FIXTURES_DIR", fixturesDir)
+	frontendDir = getEnv("FRONTEND_DIR", frontendDir)
+	serveFrontend = getEnv("SERVE_FRONTEND", "true") != "false"
+	geojsonMaxAge = getEnvDuration("GEOJSON_MAX_AGE", geojsonMaxAge)
+	switch strategy := getEnv("PREDICTION_STRATEGY", predictionStrategy); strategy {
+	case strategyAll, strategyActive:
+		predictionStrategy = strategy
+	default:
+		slog.Warn("invalid prediction strategy, using default", "var", "PREDICTION_STRATEGY", "value", strategy, "default", predictionStrategy)
+	}
+	activeStationWindow = getEnvDuration("ACTIVE_STATION_WINDOW", activeStationWindow)
+	activeStationMax = getEnvInt("ACTIVE_STATION_MAX", activeStationMax)
+	predictionLimitMax = getEnvInt("PREDICTION_LIMIT_MAX", predictionLimitMax)
+	predictionMaxMinutes = getEnvInt("PREDICTION_MAX_MINUTES", predictionMaxMinutes)
+	searchResultLimit = getEnvInt("SEARCH_RESULT_LIMIT", searchResultLimit)
+	wmataRateLimit = getEnvFloat("WMATA_RATE_LIMIT", wmataRateLimit)
+	rateLimitRPS = getEnvFloat("RATE_LIMIT_RPS", rateLimitRPS)
+	rateLimitBurst = getEnvInt("RATE_LIMIT_BURST", rateLimitBurst)
+	if size := getEnvInt("PREDICTION_HISTORY_SIZE", predictionHistorySize); size != predictionHistorySize {
+		predictionHistorySize = size
+		predictionHistory = newRingBuffer[PredictionSnapshot](predictionHistorySize)
+	}
+	if size := getEnvInt("PATH_CACHE_SIZE", pathCacheSize); size != pathCacheSize {
+		pathCacheSize = size
+		cachedPaths = newLRUCache[string, []PathItem](pathCacheSize)
+		cachedTravelTimes = newLRUCache[string, []StationToStation](pathCacheSize)
+	}
+	cacheTTL.Predictions = predictionRefreshInterval + predictionCacheBuffer // Keep cache validity in step with the refresh loop
+	cacheTTL = cacheDurationsFromEnv(cacheTTL)
+
+	fmt.Printf("==== Server running on :%s ====\n", port)
+	if serveFrontend {
+		fmt.Printf("Frontend: http://localhost:%s\n", port)
+	}
+	fmt.Printf("API: http://localhost:%s/stations\n", port)
+
+	// Check the API key before doing anything else, a bad key would otherwise just mean empty caches and 500s
+	// Fixtures don't need one, see fixtures.go
+	if usingFixtures() {
+		slog.Warn("DATA_SOURCE=fixtures, serving bundled fixture data instead of calling WMATA", "dir", fixturesDir)
+	} else if err := validateAPIKey(apiKey); err != nil {
+		if errors.Is(err, errAPIKeyMissing) || errors.Is(err, errAPIKeyRejected) {
+			slog.Error("Invalid WMATA API key", "err", err)
+			os.Exit(1)
+		}
+		// Anything else (network down, WMATA 5xx) isn't the key's fault, so start anyway and let refreshes retry
+		slog.Warn("Could not validate WMATA API key, starting anyway", "err", err)
+	}
+
+	// Pre-warm caches in the background while the server starts listening.
+	// Until a cache is warm its handlers answer 503 + Retry-After (see errWarmingUp) instead of 500.
+	staticWarming.Store(true)
+	predictionsWarming.Store(true)
+	go prewarmCaches(apiKey)
+
+	// Forget rate limit buckets for clients idle longer than 10 minutes
+	go cleanupClientLimiters(10 * time.Minute)
+
+	// Catch a broken .geojson edit now rather than in the browser
+	validateGeoJSONFiles()
+
+	// Register API handlers
+	registerHandlers(apiKey)
+
+	// Serve frontend static files from ../frontend directory (see registerFrontend)
+	// Files are served at the root path ("/"), API handlers take precedence
+	registerFrontend()
+
+	if err := newServer(port).ListenAndServe(); err != nil {
+		slog.Error("Server stopped", "err", err)
+		os.Exit(1)
+	}
+}
+
+// prewarmCaches loads every cache once on startup, then starts the background refresh loops
+// Runs sequentially to avoid rate limiting. Predictions go first since they're one fast call,
+// so arrival boards work while the slower static data is still loading.
+func prewarmCaches(apiKey string) {
+	slog.Info("Pre-warming caches...")
+	if _, err := refreshTrainPredictions(context.Background(), apiKey); err != nil {
+		slog.Error("Failed to pre-warm predictions cache", "err", err)
+	} else {
+		markPredictionLoopRan() // Counts as the loop's first run, /health would otherwise call it stale until the next one
 	}
-	if _, err := refreshTrainPredictions(apiKey); err != nil {
-		log.Println("ERROR: Failed to pre-warm predictions cache:", err)
+	predictionsWarming.Store(false)
+
+	// Static data comes from the disk cache when it's fresh enough, skipping the slow WMATA calls
+	if err := loadStaticCache(); err != nil {
+		slog.Info("No usable disk cache, fetching static data", "reason", err.Error())
+		if _, err := refreshAllStations(context.Background(), apiKey); err != nil {
+			slog.Error("Failed to pre-warm static cache", "err", err)
+		}
 	}
-	log.Println("Caches pre-warmed successfully!")
+	staticWarming.Store(false)
+	slog.Info("Caches pre-warmed successfully!")
 
 	// Start background refresh loops (now that initial data is loaded)
-	go startBackgroundRefresh("Predictions", 20*time.Second, func() error {
-		_, err := refreshTrainPredictions(apiKey)
-		return err
+	go startBackgroundRefresh("Predictions", predictionRefreshInterval, func() error {
+		return refreshPredictionsByStrategy(context.Background(), apiKey)
 	})
-	go startBackgroundRefresh("Static Data", 24*time.Hour, func() error {
-		_, err := refreshAllStations(apiKey)
+	go startBackgroundRefresh("Static Data", staticRefreshInterval, func() error {
+		_, err := refreshAllStations(context.Background(), apiKey)
 		return err
 	})
+}
 
-	// Register API handlers
-	registerHandlers(apiKey)
+// getEnv returns the environment variable, or the fallback when it's unset/empty
+func getEnv(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
 
-	// Serve frontend static files from ../frontend directory
-	// This allows Go to serve index.html, script.js, style.css, etc.
-	// Files are served at the root path ("/"), API handlers take precedence
-	fs := http.FileServer(http.Dir("../frontend"))
-	http.Handle("/", fs)
+// getEnvDuration parses an environment variable like "30s" or "12h" with time.ParseDuration
+// Falls back (with a log line) when the variable is unset, unparseable, or not positive.
+func getEnvDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		slog.Warn("invalid duration, using default", "var", name, "value", value, "default", fallback.String())
+		return fallback
+	}
+	return d
+}
+
+// cacheDurationsFromEnv applies the CACHE_TTL_* overrides on top of the given defaults
+func cacheDurationsFromEnv(d cacheDurations) cacheDurations {
+	d.Stations = getEnvDuration("CACHE_TTL_STATIONS", d.Stations)
+	d.Entrances = getEnvDuration("CACHE_TTL_ENTRANCES", d.Entrances)
+	d.Lines = getEnvDuration("CACHE_TTL_LINES", d.Lines)
+	d.Parking = getEnvDuration("CACHE_TTL_PARKING", d.Parking)
+	d.StationTimes = getEnvDuration("CACHE_TTL_STATION_TIMES", d.StationTimes)
+	d.Predictions = getEnvDuration("CACHE_TTL_PREDICTIONS", d.Predictions)
+	d.Outages = getEnvDuration("CACHE_TTL_OUTAGES", d.Outages)
+	d.Incidents = getEnvDuration("CACHE_TTL_INCIDENTS", d.Incidents)
+	d.BusPredictions = getEnvDuration("CACHE_TTL_BUS_PREDICTIONS", d.BusPredictions)
+	d.NearbyEntrances = getEnvDuration("CACHE_TTL_NEARBY_ENTRANCES", d.NearbyEntrances)
+	return d
+}
+
+// getEnvInt parses an integer environment variable, falling back when unset or invalid (negative counts as invalid)
+func getEnvInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		slog.Warn("invalid integer, using default", "var", name, "value", value, "default", fallback)
+		return fallback
+	}
+	return n
+}
 
-	log.Fatal(http.ListenAndServe(":8080", nil))
+// getEnvFloat parses a decimal environment variable like "2.5", falling back when unset or invalid
+func getEnvFloat(name string, fallback float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 {
+		slog.Warn("invalid number, using default", "var", name, "value", value, "default", fallback)
+		return fallback
+	}
+	return f
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus metrics, served at /metrics (see handlers.go) for Grafana etc.
+// promauto registers each metric with the default registry as it's created.
+var (
+	wmataRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wmata_requests_total",
+		Help: "Total WMATA API requests, by endpoint path.",
+	}, []string{"endpoint"})
+
+	wmataRequestFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "wmata_request_failures_total",
+		Help: "WMATA API requests that errored or returned a non-200 status, by endpoint path.",
+	}, []string{"endpoint"})
+
+	wmataThrottledTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "wmata_throttled_total",
+		Help: "WMATA API requests that had to wait for the shared WMATA rate limit.",
+	})
+
+	refreshDurationSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "transit_refresh_duration_seconds",
+		Help:    "Time spent fetching a full cache refresh from WMATA.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"cache"}) // "static" or "predictions"
+
+	cacheRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "transit_cache_requests_total",
+		Help: "Cache lookups from the fetch* helpers, by cache and result (hit, stale or miss).",
+	}, []string{"cache", "result"})
+
+	cachedPredictionsGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "transit_cached_predictions",
+		Help: "Number of train predictions currently cached.",
+	})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "transit_stream_subscribers",
+		Help: "Connected SSE and WebSocket prediction clients.",
+	}, func() float64 { return float64(predictionUpdates.Count()) })
+)
+
+// wmataEndpointLabel turns a request URL into a metric label, e.g. "/Rail.svc/json/jStationInfo"
+// The query string is dropped so every station code doesn't become its own time series, and so is an ID
+// in the path itself (see wmataPathIDs): GetPrediction/A01,C01 is labelled GetPrediction/{codes}.
+func wmataEndpointLabel(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "unknown"
+	}
+	for prefix, placeholder := range wmataPathIDs {
+		if id, ok := strings.CutPrefix(parsed.Path, prefix); ok && id != "" && id != "All" {
+			return prefix + placeholder
+		}
+	}
+	return parsed.Path
+}
+
+// wmataPathIDs lists the WMATA paths that end in an ID rather than a fixed name, with the placeholder
+// used in their label. "All" is kept as it is, it's one fixed (and much bigger) call.
+var wmataPathIDs = map[string]string{
+	"/StationPrediction.svc/json/GetPrediction/": "{codes}",
+}
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestWMATAEndpointLabel(t *testing.T) {
+	tests := map[string]string{
+		wmataURL("/Rail.svc/json/jStationInfo?StationCode=A01"):                "/Rail.svc/json/jStationInfo",
+		wmataURL("/Rail.svc/json/jStationInfo?StationCode=K08"):                "/Rail.svc/json/jStationInfo",
+		wmataURL("/StationPrediction.svc/json/GetPrediction/All"):              "/StationPrediction.svc/json/GetPrediction/All",
+		wmataURL("/StationPrediction.svc/json/GetPrediction/A01"):              "/StationPrediction.svc/json/GetPrediction/{codes}",
+		wmataURL("/StationPrediction.svc/json/GetPrediction/A01,C01"):          "/StationPrediction.svc/json/GetPrediction/{codes}",
+		wmataURL("/NextBusService.svc/json/jPredictions?StopID=1001195"):       "/NextBusService.svc/json/jPredictions",
+		wmataURL("/Rail.svc/json/jPath?FromStationCode=A01&ToStationCode=A15"): "/Rail.svc/json/jPath",
+		"://not a url": "unknown",
+	}
+	for rawURL, want := range tests {
+		if got := wmataEndpointLabel(rawURL); got != want {
+			t.Errorf("wmataEndpointLabel(%q) = %q, want %q", rawURL, got, want)
+		}
+	}
+}
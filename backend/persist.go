@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Disk persistence for the static caches, so restarts don't have to wait on dozens of WMATA calls.
+// After every successful refreshAllStations the caches are written to one JSON file,
+// and on startup that file is loaded (if it's still fresh) instead of pre-warming from the API.
+// The file is gzipped (the JSON shrinks to a fraction of its size). Files from before compression are plain JSON,
+// and loadStaticCache tells the two apart by gzip's magic bytes, so the name stays the same across the upgrade.
+
+var staticCacheFile = "static_cache.json" // Overridable via STATIC_CACHE_FILE, see main.go
+
+// persistedStaticCache struct: Everything refreshAllStations caches, plus when it was fetched
+type persistedStaticCache struct {
+	CacheTime time.Time         `json:"cacheTime"`
+	Stations  []StationInfo     `json:"stations"`
+	Entrances []StationEntrance `json:"entrances"`
+	Lines     []Lines           `json:"lines"`
+	Parking   []StationParking  `json:"parking"`
+	Times     []StationTime     `json:"stationTimes"`
+}
+
+// persisted gathers the bundle's datasets into their on-disk shape (the indexes are rebuilt on load)
+func (b staticBundle) persisted() persistedStaticCache {
+	return persistedStaticCache{
+		CacheTime: b.StationsFetch.FetchedAt,
+		Stations:  b.Stations,
+		Entrances: b.Entrances,
+		Lines:     b.Lines,
+		Parking:   b.Parking,
+		Times:     b.StationTimes,
+	}
+}
+
+// updateStaticChecksum rehashes bundle's datasets after a refresh, before it's stored
+// The checksum only changes when WMATA's data does (a new station, a schedule change), so it's shown in /health.
+// The hash is over the same JSON that goes to disk, minus the fetch time. Anything that changes it gets a Warn line
+// with event=static_data_changed, so monitoring can alert on it without diffing the data itself.
+func updateStaticChecksum(bundle *staticBundle) {
+	persisted := bundle.persisted()
+	persisted.CacheTime = time.Time{} // Otherwise every refresh would look like a change
+	data, err := json.Marshal(persisted)
+	if err != nil {
+		slog.Error("checksumming static cache failed", "err", err)
+		return
+	}
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+
+	previous := bundle.Checksum // Still the stored bundle's, bundle is a copy of it
+	bundle.Checksum = checksum
+	if previous != "" && previous != checksum {
+		slog.Warn("[Static] WMATA data changed", "event", "static_data_changed", "previous_checksum", previous, "checksum", checksum)
+		return
+	}
+	slog.Info("[Static] checksum", "checksum", checksum)
+}
+
+// gzipMagic is how every gzip stream starts, used to spot a compressed cache file
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// saveStaticCache writes bundle to disk, gzipped. Caller must hold cacheMutex, so two saves can't race on the temp file.
+// Writes to a temp file then renames it, so a crash mid-write never leaves a half-written cache file.
+func saveStaticCache(bundle staticBundle) error {
+	if usingFixtures() {
+		return nil // Fixture data must never end up in the cache a live restart would load
+	}
+	data, err := json.Marshal(bundle.persisted())
+	if err != nil {
+		return err
+	}
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil { // Close flushes the last block, the file is truncated without it
+		return err
+	}
+
+	tmpFile := staticCacheFile + ".tmp"
+	if err := os.WriteFile(tmpFile, compressed.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, staticCacheFile)
+}
+
+// readStaticCacheFile returns the cache file's JSON, decompressing it if it's gzipped
+// Plain JSON files (written before compression was added) are returned as they are.
+func readStaticCacheFile() ([]byte, error) {
+	data, err := os.ReadFile(staticCacheFile)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, gzipMagic) {
+		return data, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// loadStaticCache fills the static caches from disk
+// Returns an error (and leaves the caches untouched) if the file is missing, unreadable, empty, or stale.
+func loadStaticCache() error {
+	if usingFixtures() {
+		return errors.New("disk cache isn't used with DATA_SOURCE=fixtures")
+	}
+	data, err := readStaticCacheFile()
+	if err != nil {
+		return err
+	}
+
+	var persisted persistedStaticCache
+	if err := json.Unmarshal(data, &persisted); err != nil {
+		return err
+	}
+	if len(persisted.Stations) == 0 {
+		return errors.New("cache file has no stations")
+	}
+	if age := time.Since(persisted.CacheTime); age >= cacheTTL.Stations {
+		return errors.New("cache file is stale (" + age.Round(time.Minute).String() + " old)")
+	}
+
+	normalizeStationTogether(persisted.Stations) // Files written before normalization existed may still have bad pairs
+
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	bundle := staticData()
+	bundle.Stations = persisted.Stations
+	bundle.StationsByLine = indexStationsByLine(bundle.Stations)
+	bundle.Entrances = persisted.Entrances
+	bundle.EntrancesByStation = indexEntrances(bundle.Entrances)
+	bundle.Lines = persisted.Lines
+	bundle.Parking = persisted.Parking
+	bundle.StationTimes = persisted.Times
+	bundle.StationsFetch.FetchedAt = persisted.CacheTime // Not AttemptedAt, nothing was fetched from WMATA
+	for _, dataset := range []*staticDataset{&bundle.EntrancesFetch, &bundle.LinesFetch, &bundle.ParkingFetch, &bundle.StationTimesFetch} {
+		dataset.markFetched(persisted.CacheTime) // Everything in the file was fetched together
+	}
+	updateStaticChecksum(&bundle) // The next refresh compares against this, so changes while we were down get logged too
+	staticCache.Set(cacheKeyAll, bundle)
+
+	slog.Info("[Static] Loaded from disk",
+		"file", staticCacheFile,
+		"age_minutes", int(time.Since(persisted.CacheTime).Minutes()),
+		"stations", len(bundle.Stations),
+	)
+	return nil
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Helpers for working with train predictions (filtering, ordering)
+
+// Most predictions a plain /nexttrains list returns, even when ?limit= asks for more. Overridable via
+// PREDICTION_LIMIT_MAX, 0 (the default) means no cap.
+var predictionLimitMax = 0
+
+// Longest wait a prediction can plausibly show, overridable via PREDICTION_MAX_MINUTES.
+// WMATA occasionally sends values like "100", which get flagged as Suspect (see suspectMin).
+var predictionMaxMinutes = 60
+
+// Helper function to filter predictions down to the given station codes
+// Returns a new slice, so the slice shared through predictionCache is never modified.
+func filterPredictionsByCode(predictions []TrainPrediction, codes []string) []TrainPrediction {
+	// A map works like a set here (like HashSet in Rust), O(1) lookups per prediction
+	wanted := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		if code = strings.TrimSpace(code); code != "" {
+			wanted[code] = true
+		}
+	}
+
+	filtered := []TrainPrediction{} // Non-nil so an empty result encodes as [] instead of null
+	for _, p := range predictions {
+		if wanted[p.LocationCode] {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+// Helper function to filter predictions down to the given line codes (e.g. "RD", "BL")
+// Returns a new slice, like filterPredictionsByCode.
+func filterPredictionsByLine(predictions []TrainPrediction, lineCodes []LineCode) []TrainPrediction {
+	wanted := make(map[LineCode]bool, len(lineCodes))
+	for _, code := range lineCodes {
+		wanted[code] = true
+	}
+
+	filtered := []TrainPrediction{}
+	for _, p := range predictions {
+		if wanted[LineCode(p.Line)] {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+// Destination texts WMATA uses for trains not carrying passengers (deadheads, trains heading to the yard)
+// Spelling varies between feeds, so they're compared case-insensitively, see isNonRevenue.
+var nonRevenueDestinations = []string{"No Passenger", "NoPssenger", "No Psngr", "ssenger"}
+
+// isNonRevenue reports whether riders can't board this train: line "No", no line at all ("" or "--",
+// which the frontend already draws with the "No Passenger" icon), or one of the destinations above
+func isNonRevenue(p TrainPrediction) bool {
+	switch strings.TrimSpace(p.Line) {
+	case string(LineNoPassengers), "", "--":
+		return true
+	}
+	for _, marker := range nonRevenueDestinations {
+		if strings.EqualFold(strings.TrimSpace(p.Destination), marker) || strings.EqualFold(strings.TrimSpace(p.DestinationName), marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper function to drop non-revenue trains (see isNonRevenue)
+// Returns a new slice, like filterPredictionsByCode.
+func filterRevenuePredictions(predictions []TrainPrediction) []TrainPrediction {
+	filtered := []TrainPrediction{}
+	for _, p := range predictions {
+		if !isNonRevenue(p) {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+// Status values derived from a prediction's Min field (see parseMin)
+const (
+	statusBoarding = "boarding" // Min == "BRD"
+	statusArriving = "arriving" // Min == "ARR"
+	statusEnRoute  = "enroute"  // Min is a number of minutes
+	statusUnknown  = "unknown"  // Min is "", "---", or anything else we don't recognise
+)
+
+// parseMin interprets WMATA's Min string: "BRD" (boarding), "ARR" (arriving), a number of minutes, or junk
+// Returns the minutes (nil unless Min is a number) and one of the status constants above.
+func parseMin(min string) (*int, string) {
+	switch min = strings.TrimSpace(min); min {
+	case "BRD":
+		return nil, statusBoarding
+	case "ARR":
+		return nil, statusArriving
+	}
+	minutes, err := strconv.Atoi(min)
+	if err != nil || minutes < 0 {
+		return nil, statusUnknown
+	}
+	return &minutes, statusEnRoute
+}
+
+// parseCar interprets WMATA's Car string ("6", "8"), returning nil for "-", blanks, or anything non-numeric
+func parseCar(car string) *int {
+	cars, err := strconv.Atoi(strings.TrimSpace(car))
+	if err != nil || cars <= 0 {
+		return nil
+	}
+	return &cars
+}
+
+// enrichPrediction fills in the computed MinutesInt, Status, Suspect and CarCount fields
+func enrichPrediction(p *TrainPrediction) {
+	p.MinutesInt, p.Status = parseMin(p.Min)
+	p.Suspect = suspectMin(p.Min, p.MinutesInt)
+	p.CarCount = parseCar(p.Car)
+}
+
+// suspectMin reports whether a Min value looks like garbage rather than a real prediction:
+// a number of minutes above predictionMaxMinutes, or text that isn't BRD/ARR/a number.
+// Blank and "---" aren't suspect, WMATA sends those for trains without a time yet.
+func suspectMin(min string, minutes *int) bool {
+	if minutes != nil {
+		return *minutes > predictionMaxMinutes
+	}
+	switch strings.TrimSpace(min) {
+	case "BRD", "ARR", "", "---":
+		return false
+	}
+	return true
+}
+
+// countSuspect counts the predictions enrichPrediction flagged, for the refresh's log line
+func countSuspect(predictions []TrainPrediction) int {
+	n := 0
+	for _, p := range predictions {
+		if p.Suspect {
+			n++
+		}
+	}
+	return n
+}
+
+// resolvePredictionNames replaces LocationName and DestinationName with the station list's names for
+// LocationCode and DestinationCode. WMATA sometimes sends these blank or abbreviated.
+// A name is only replaced when its code is a known station. "No Passenger" and "Train" entries have no
+// DestinationCode, so they keep WMATA's text.
+func resolvePredictionNames(p *TrainPrediction, names map[string]string) {
+	if name, ok := names[p.LocationCode]; ok && name != "" {
+		p.LocationName = name
+	}
+	if name, ok := names[p.DestinationCode]; ok && name != "" {
+		p.DestinationName = name
+	}
+}
+
+// minSortRank turns a prediction's Min string into a sortable number
+// BRD and ARR come before any numeric time, and anything we can't parse goes to the very end.
+func minSortRank(min string) int {
+	minutes, status := parseMin(min)
+	switch status {
+	case statusBoarding:
+		return -2
+	case statusArriving:
+		return -1
+	case statusEnRoute:
+		return *minutes
+	}
+	return math.MaxInt // Unknown values sort last
+}
+
+// comparePredictions orders two predictions by arrival: negative if a comes first, positive if b does, 0 for a tie
+// BRD < ARR < 0 < 1 < ... minutes < anything unparseable ("", "---", junk), see minSortRank.
+// Ties (same minutes, or both unknown) are 0 rather than broken on another field, so a stable sort
+// keeps WMATA's own order for them.
+func comparePredictions(a, b TrainPrediction) int {
+	return cmp.Compare(minSortRank(a.Min), minSortRank(b.Min))
+}
+
+// sortPredictions returns a copy of the predictions ordered by arrival time (see comparePredictions)
+// Copies first because the input may be the slice stored in predictionCache, which other requests read.
+// SliceStable keeps trains with equal times in their original (WMATA) order.
+func sortPredictions(predictions []TrainPrediction) []TrainPrediction {
+	sorted := make([]TrainPrediction, len(predictions))
+	copy(sorted, predictions)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return comparePredictions(sorted[i], sorted[j]) < 0
+	})
+	return sorted
+}
+
+// predictionLimit works out how many predictions to return: the smaller of ?limit= and predictionLimitMax,
+// where 0 means "no limit" for either. An invalid ?limit= is an error.
+func predictionLimit(r *http.Request) (int, error) {
+	limit := 0
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		var err error
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 1 {
+			return 0, errors.New("limit must be a positive integer")
+		}
+	}
+	if predictionLimitMax > 0 && (limit == 0 || limit > predictionLimitMax) {
+		limit = predictionLimitMax
+	}
+	return limit, nil
+}
+
+// arrivalMinutes returns a prediction's minutes for headway maths: BRD/ARR count as 0, unknown = false
+func arrivalMinutes(p TrainPrediction) (int, bool) {
+	minutes, status := parseMin(p.Min)
+	switch status {
+	case statusBoarding, statusArriving:
+		return 0, true
+	case statusEnRoute:
+		return *minutes, true
+	}
+	return 0, false
+}
+
+// summarizeCars averages train length (CarCount) per line, in first-seen line order
+// Longer trains mean more room, so this works as a lightweight crowding hint.
+// Trains without a car count still get their line listed, but aren't part of the average.
+func summarizeCars(predictions []TrainPrediction) []LineCarSummary {
+	summaries := []LineCarSummary{}
+	lineIndex := make(map[string]int) // Line -> position in summaries
+	totalCars := make(map[string]int)
+	for _, p := range predictions {
+		i, ok := lineIndex[p.Line]
+		if !ok {
+			i = len(summaries)
+			lineIndex[p.Line] = i
+			summaries = append(summaries, LineCarSummary{Line: p.Line})
+		}
+		if p.CarCount != nil {
+			summaries[i].Trains++
+			totalCars[p.Line] += *p.CarCount
+		}
+	}
+
+	for i := range summaries {
+		if summaries[i].Trains > 0 {
+			summaries[i].AverageCars = float64(totalCars[summaries[i].Line]) / float64(summaries[i].Trains)
+		}
+	}
+	return summaries
+}
+
+// mergePredictionsByStation collapses predictions into one entry per transfer complex (/nexttrains?merge=true)
+// Complexes come from mergeStations, so the Code and Name are the canonical station's. Trains keep their own
+// LocationCode and Group, because Group is per platform: Group "1" at A01 and Group "1" at C01 aren't the same direction.
+// A train listed under two platforms of the same complex (same line, destination, Group, Min and Car) is only kept once.
+// Stations without a train are left out, and each complex's trains are sorted soonest first.
+func mergePredictionsByStation(predictions []TrainPrediction, stations []StationInfo) []StationPredictions {
+	complexOf := make(map[string]int) // Station code -> position in complexes
+	complexes := mergeStations(stations)
+	for i, station := range complexes {
+		for _, code := range station.Codes {
+			complexOf[code] = i
+		}
+	}
+
+	merged := []StationPredictions{}
+	mergedIndex := make(map[int]int)  // Position in complexes -> position in merged
+	seenAt := make(map[string]string) // Complex + train key -> the LocationCode it was first seen at
+	for _, p := range predictions {
+		c, ok := complexOf[p.LocationCode]
+		if !ok {
+			// Not in the station list, so it gets an entry of its own
+			c = len(complexes)
+			complexes = append(complexes, MergedStation{Code: p.LocationCode, Codes: []string{p.LocationCode}, Name: p.LocationName})
+			complexOf[p.LocationCode] = c
+		}
+
+		key := fmt.Sprintf("%d|%s|%s|%s|%s|%s", c, p.Line, p.DestinationCode, p.Group, p.Min, p.Car)
+		if at, dup := seenAt[key]; dup && at != p.LocationCode {
+			continue
+		}
+		seenAt[key] = p.LocationCode
+
+		i, ok := mergedIndex[c]
+		if !ok {
+			i = len(merged)
+			mergedIndex[c] = i
+			merged = append(merged, StationPredictions{Code: complexes[c].Code, Codes: complexes[c].Codes, Name: complexes[c].Name})
+		}
+		merged[i].Trains = append(merged[i].Trains, p)
+	}
+
+	for i := range merged {
+		merged[i].Trains = sortPredictions(merged[i].Trains)
+	}
+	return merged
+}
+
+// How many upcoming trains ?grouped=true and ?board=true show per group, like the signs on the platform
+const trainsPerGroup = 3
+
+// groupPredictions groups a station's predictions by destination and track Group, soonest first,
+// keeping the next three trains per group and the gaps (headways) in minutes between them.
+// Trains with an unknown Min are still listed, but skipped when working out headways.
+func groupPredictions(predictions []TrainPrediction) []PredictionGroup {
+	groups := []PredictionGroup{}      // Non-nil so no trains encodes as [] instead of null
+	groupIndex := make(map[string]int) // "DestinationCode|Group" -> position in groups
+	for _, p := range sortPredictions(predictions) {
+		key := p.DestinationCode + "|" + p.Group
+		i, ok := groupIndex[key]
+		if !ok {
+			i = len(groups)
+			groupIndex[key] = i
+			groups = append(groups, PredictionGroup{
+				DestinationCode: p.DestinationCode,
+				DestinationName: p.DestinationName,
+				Group:           p.Group,
+				Line:            p.Line,
+				Headways:        []int{},
+			})
+		}
+		if len(groups[i].Trains) < trainsPerGroup {
+			groups[i].Trains = append(groups[i].Trains, p)
+		}
+	}
+
+	for i := range groups {
+		prev, havePrev := 0, false
+		for _, train := range groups[i].Trains {
+			minutes, ok := arrivalMinutes(train)
+			if !ok {
+				continue
+			}
+			if havePrev {
+				groups[i].Headways = append(groups[i].Headways, minutes-prev)
+			}
+			prev, havePrev = minutes, true
+		}
+	}
+	return groups
+}
+
+// boardPredictions lays a station's predictions out like a platform display (/nexttrains?code=&board=true):
+// one row per track Group, in Group order ("1" before "2"), each with its next three trains soonest first.
+// Unlike groupPredictions every destination shares a row, since that's how the real signs work.
+// Suspect predictions are left off, a board shouldn't show "100 min".
+func boardPredictions(predictions []TrainPrediction) []BoardRow {
+	rows := []BoardRow{}
+	rowIndex := make(map[string]int) // Group -> position in rows
+	for _, p := range sortPredictions(predictions) {
+		if p.Suspect {
+			continue
+		}
+		i, ok := rowIndex[p.Group]
+		if !ok {
+			i = len(rows)
+			rowIndex[p.Group] = i
+			rows = append(rows, BoardRow{Group: p.Group, Trains: []TrainPrediction{}})
+		}
+		if len(rows[i].Trains) < trainsPerGroup {
+			rows[i].Trains = append(rows[i].Trains, p)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Group < rows[j].Group })
+	return rows
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// Tests for the prediction helpers in predictions.go. Plain table tests, no WMATA calls.
+
+func TestComparePredictions(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string // Min values
+		want int    // Sign of the result: -1 = a first, 1 = b first, 0 = tie
+	}{
+		{"boarding before arriving", "BRD", "ARR", -1},
+		{"arriving before 0 minutes", "ARR", "0", -1},
+		{"boarding before numeric", "BRD", "3", -1},
+		{"fewer minutes first", "2", "10", -1},
+		{"more minutes last", "12", "4", 1},
+		{"same minutes tie", "5", "5", 0},
+		{"zero-padded equals plain", "05", "5", 0},
+		{"zero-padded compares numerically", "09", "10", -1},
+		{"numeric before blank", "20", "", -1},
+		{"numeric before dashes", "20", "---", -1},
+		{"negative sorts as unknown", "-1", "7", 1},
+		{"junk sorts last", "abc", "BRD", 1},
+		{"blank and dashes tie", "", "---", 0},
+		{"blank and junk tie", "", "x", 0},
+		{"two boarding tie", "BRD", "BRD", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := comparePredictions(TrainPrediction{Min: tt.a}, TrainPrediction{Min: tt.b})
+			if sign(got) != tt.want {
+				t.Errorf("comparePredictions(%q, %q) = %d, want sign %d", tt.a, tt.b, got, tt.want)
+			}
+			// Swapping the arguments has to flip the answer, or the sort order would depend on input order
+			if back := comparePredictions(TrainPrediction{Min: tt.b}, TrainPrediction{Min: tt.a}); sign(back) != -tt.want {
+				t.Errorf("comparePredictions(%q, %q) = %d, want sign %d", tt.b, tt.a, back, -tt.want)
+			}
+		})
+	}
+}
+
+func TestSortPredictionsKeepsTiesInOrder(t *testing.T) {
+	// Trains with the same Min (and all the unknown ones) must keep WMATA's order, see sortPredictions
+	input := []TrainPrediction{
+		{Min: "---", Destination: "unknown1"},
+		{Min: "5", Destination: "five1"},
+		{Min: "BRD", Destination: "brd"},
+		{Min: "5", Destination: "five2"},
+		{Min: "", Destination: "unknown2"},
+		{Min: "05", Destination: "five3"},
+		{Min: "ARR", Destination: "arr"},
+		{Min: "junk", Destination: "unknown3"},
+	}
+	want := []string{"brd", "arr", "five1", "five2", "five3", "unknown1", "unknown2", "unknown3"}
+
+	sorted := sortPredictions(input)
+	if len(sorted) != len(want) {
+		t.Fatalf("got %d predictions, want %d", len(sorted), len(want))
+	}
+	for i, dest := range want {
+		if sorted[i].Destination != dest {
+			t.Errorf("position %d: got %q, want %q", i, sorted[i].Destination, dest)
+		}
+	}
+	if input[0].Destination != "unknown1" {
+		t.Error("sortPredictions modified its input")
+	}
+}
+
+func TestParseMin(t *testing.T) {
+	tests := []struct {
+		min        string
+		wantOK     bool // MinutesInt is non-nil
+		wantMins   int
+		wantStatus string
+	}{
+		{"BRD", false, 0, statusBoarding},
+		{"ARR", false, 0, statusArriving},
+		{" BRD ", false, 0, statusBoarding},
+		{"", false, 0, statusUnknown},
+		{"---", false, 0, statusUnknown},
+		{"0", true, 0, statusEnRoute},
+		{"1", true, 1, statusEnRoute},
+		{"12", true, 12, statusEnRoute},
+		{"05", true, 5, statusEnRoute},
+		{" 7", true, 7, statusEnRoute},
+		{"7 ", true, 7, statusEnRoute},
+		{"\t3\n", true, 3, statusEnRoute},
+		{"-3", false, 0, statusUnknown},
+		{"brd", false, 0, statusUnknown},
+		{"5 min", false, 0, statusUnknown},
+		{"1.5", false, 0, statusUnknown},
+		{"abc", false, 0, statusUnknown},
+	}
+
+	for _, tt := range tests {
+		minutes, status := parseMin(tt.min)
+		if status != tt.wantStatus {
+			t.Errorf("parseMin(%q) status = %q, want %q", tt.min, status, tt.wantStatus)
+		}
+		if (minutes != nil) != tt.wantOK {
+			t.Errorf("parseMin(%q) minutes = %v, want non-nil %v", tt.min, minutes, tt.wantOK)
+			continue
+		}
+		if minutes != nil && *minutes != tt.wantMins {
+			t.Errorf("parseMin(%q) = %d, want %d", tt.min, *minutes, tt.wantMins)
+		}
+	}
+}
+
+// Bad Min values as WMATA has sent them, next to ordinary trains at the same platform
+func suspectFixture() []TrainPrediction {
+	return []TrainPrediction{
+		{Min: "3", Group: "1", Line: "RD", Car: "8", DestinationName: "Glenmont"},
+		{Min: "-4", Group: "1", Line: "RD", Car: "8", DestinationName: "Glenmont"},
+		{Min: "100", Group: "1", Line: "RD", Car: "6", DestinationName: "Glenmont"},
+		{Min: "999", Group: "2", Line: "RD", Car: "8", DestinationName: "Shady Grove"},
+		{Min: "??", Group: "2", Line: "RD", Car: "8", DestinationName: "Shady Grove"},
+		{Min: "soon", Group: "2", Line: "RD", Car: "8", DestinationName: "Shady Grove"},
+		{Min: "BRD", Group: "2", Line: "RD", Car: "6", DestinationName: "Shady Grove"},
+		{Min: "ARR", Group: "1", Line: "RD", Car: "8", DestinationName: "Glenmont"},
+		{Min: "---", Group: "1", Line: "RD", Car: "-", DestinationName: "Glenmont"},
+		{Min: "", Group: "2", Line: "RD", Car: "", DestinationName: "Shady Grove"},
+		{Min: "60", Group: "2", Line: "RD", Car: "8", DestinationName: "Shady Grove"},
+	}
+}
+
+func TestEnrichPredictionFlagsSuspect(t *testing.T) {
+	wantSuspect := map[string]bool{
+		"3": false, "-4": true, "100": true, "999": true, "??": true, "soon": true,
+		"BRD": false, "ARR": false, "---": false, "": false, "60": false, // 60 = predictionMaxMinutes, still plausible
+	}
+
+	for _, p := range suspectFixture() {
+		original := p
+		enrichPrediction(&p)
+		if p.Suspect != wantSuspect[p.Min] {
+			t.Errorf("Min %q: Suspect = %v, want %v", p.Min, p.Suspect, wantSuspect[p.Min])
+		}
+		// Only the computed fields change, WMATA's own values stay as they were
+		if p.Min != original.Min || p.Car != original.Car || p.Group != original.Group ||
+			p.Line != original.Line || p.DestinationName != original.DestinationName {
+			t.Errorf("Min %q: enrichPrediction changed WMATA fields: %+v -> %+v", original.Min, original, p)
+		}
+	}
+}
+
+func TestSuspectMinRespectsLimit(t *testing.T) {
+	saved := predictionMaxMinutes
+	defer func() { predictionMaxMinutes = saved }()
+	predictionMaxMinutes = 20
+
+	for min, want := range map[string]bool{"20": false, "21": true, "5": false} {
+		minutes, _ := parseMin(min)
+		if got := suspectMin(min, minutes); got != want {
+			t.Errorf("suspectMin(%q) with limit 20 = %v, want %v", min, got, want)
+		}
+	}
+}
+
+func TestBoardPredictionsDropsSuspect(t *testing.T) {
+	predictions := suspectFixture()
+	for i := range predictions {
+		enrichPrediction(&predictions[i])
+	}
+
+	rows := boardPredictions(predictions)
+	if len(rows) != 2 || rows[0].Group != "1" || rows[1].Group != "2" {
+		t.Fatalf("got rows %+v, want groups 1 and 2", rows)
+	}
+	want := map[string][]string{
+		"1": {"ARR", "3", "---"},
+		"2": {"BRD", "60", ""},
+	}
+	for _, row := range rows {
+		var mins []string
+		for _, train := range row.Trains {
+			if train.Suspect {
+				t.Errorf("group %s: suspect train %q on the board", row.Group, train.Min)
+			}
+			mins = append(mins, train.Min)
+		}
+		if !slices.Equal(mins, want[row.Group]) {
+			t.Errorf("group %s: got %q, want %q", row.Group, mins, want[row.Group])
+		}
+	}
+}
+
+// sign maps a comparison result to -1, 0 or 1
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
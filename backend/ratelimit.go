@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Per-client rate limiting for the public API handlers (applied in apiHandler).
+// Each client IP gets its own token bucket: it can burst up to rateLimitBurst requests,
+// then refills at rateLimitRPS requests per second. Over the limit = 429 Too Many Requests.
+
+var (
+	rateLimitRPS   = 10.0 // Overridable via RATE_LIMIT_RPS (0 disables rate limiting)
+	rateLimitBurst = 20   // Overridable via RATE_LIMIT_BURST (at least 1, a bucket of 0 would reject everything)
+
+	clientLimiters     = make(map[string]*clientLimiter) // Keyed by client IP
+	clientLimiterMutex sync.Mutex
+)
+
+// clientLimiter is one client's token bucket, plus when we last saw them (for cleanup)
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// clientIP returns the IP part of the request's remote address
+// X-Forwarded-For is deliberately ignored: it's set by the client, so anyone could dodge the limit with it.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// limiterFor returns the token bucket for an IP, creating one on first sight
+func limiterFor(ip string) *rate.Limiter {
+	clientLimiterMutex.Lock()
+	defer clientLimiterMutex.Unlock()
+
+	client, ok := clientLimiters[ip]
+	if !ok {
+		client = &clientLimiter{limiter: rate.NewLimiter(rate.Limit(rateLimitRPS), max(rateLimitBurst, 1))}
+		clientLimiters[ip] = client
+	}
+	client.lastSeen = time.Now()
+	return client.limiter
+}
+
+// checkRateLimit returns true (after writing a 429 with Retry-After) if the client is over its limit
+func checkRateLimit(w http.ResponseWriter, r *http.Request) bool {
+	if rateLimitRPS <= 0 {
+		return false
+	}
+
+	// Reserve a token: if it's not available right now, Delay() says how long until it would be
+	reservation := limiterFor(clientIP(r)).Reserve()
+	delay := reservation.Delay()
+	if delay == 0 {
+		return false
+	}
+	reservation.Cancel() // We're rejecting the request, so give the token back
+
+	retryAfter := int(math.Ceil(delay.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	writeError(w, "Rate limit exceeded", http.StatusTooManyRequests)
+	return true
+}
+
+// Outgoing rate limiting for WMATA itself: one token bucket per API key (WMATA limits each key separately),
+// which every fetchFromWMATA call with that key waits on, so the parallel static refresh, the prediction loop
+// and on-demand fetches all share that key's budget. More keys in WMATA_API_KEY = more calls per second.
+// WMATA's default tier allows about 10 calls/second (and 50,000/day) per key.
+var wmataRateLimit = 10.0 // Calls per second per key, overridable via WMATA_RATE_LIMIT (0 disables)
+
+// newWMATALimiter builds one key's WMATA bucket (see keyPoolFor), with a burst of one second's worth of calls
+func newWMATALimiter(callsPerSecond float64) *rate.Limiter {
+	if callsPerSecond <= 0 {
+		return rate.NewLimiter(rate.Inf, 1)
+	}
+	return rate.NewLimiter(rate.Limit(callsPerSecond), max(1, int(callsPerSecond)))
+}
+
+// waitForWMATABudget blocks until the next WMATA call with limiter's key is within budget (or ctx is done)
+// Logs each call that has to wait, so a refresh that's being held back shows up in the logs.
+func waitForWMATABudget(ctx context.Context, endpoint string, limiter *rate.Limiter) error {
+	reservation := limiter.Reserve()
+	delay := reservation.Delay()
+	if delay == 0 {
+		return nil
+	}
+	wmataThrottledTotal.Inc()
+	slog.Info("throttling WMATA call", "endpoint", endpoint, "wait_ms", delay.Milliseconds())
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		reservation.Cancel() // Not making the call after all, give the token back
+		return ctx.Err()
+	}
+}
+
+// cleanupClientLimiters forgets clients that haven't made a request in a while, so the map can't grow forever
+func cleanupClientLimiters(maxIdle time.Duration) {
+	ticker := time.NewTicker(maxIdle)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		clientLimiterMutex.Lock()
+		for ip, client := range clientLimiters {
+			if time.Since(client.lastSeen) > maxIdle {
+				delete(clientLimiters, ip)
+			}
+		}
+		clientLimiterMutex.Unlock()
+	}
+}
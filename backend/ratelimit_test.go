@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckRateLimitBurstAtLeastOne(t *testing.T) {
+	savedRPS, savedBurst := rateLimitRPS, rateLimitBurst
+	t.Cleanup(func() {
+		rateLimitRPS, rateLimitBurst = savedRPS, savedBurst
+		clientLimiterMutex.Lock()
+		delete(clientLimiters, "192.0.2.1")
+		clientLimiterMutex.Unlock()
+	})
+	rateLimitRPS, rateLimitBurst = 1, 0 // RATE_LIMIT_BURST=0
+
+	request := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/stations", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		checkRateLimit(rec, r)
+		return rec
+	}
+
+	// A burst of 0 is treated as 1: the first request goes through, the next one straight after doesn't
+	if rec := request(); rec.Code != http.StatusOK {
+		t.Fatalf("first request: status %d, want it let through", rec.Code)
+	}
+	if rec := request(); rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("second request: status %d, Retry-After %q, want a 429", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestWMATABudgetIsPerKey(t *testing.T) {
+	savedRateLimit := wmataRateLimit
+	t.Cleanup(func() {
+		wmataRateLimit = savedRateLimit
+		resetKeyPools()
+	})
+	wmataRateLimit = 1 // A burst of one call per key
+	resetKeyPools()
+	pool := keyPoolFor("key-a,key-b")
+
+	// One call on each key goes straight through, only a second call on the same key has to wait
+	for i, wantWait := range []bool{false, false, true} {
+		key := pool.pick()
+		reservation := key.limiter.Reserve()
+		if waits := reservation.Delay() > 0; waits != wantWait {
+			t.Errorf("call %d (key %q): waits %v, want %v", i, key.value, waits, wantWait)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Station name search for the "jump to station" box (/search?q=)
+
+// Most results /search returns, overridable via SEARCH_RESULT_LIMIT. ?limit= can ask for fewer.
+var searchResultLimit = 10
+
+// Match quality, lower is better. Results are sorted by rank, then by name.
+const (
+	matchCode       = iota // q is the station code ("a01")
+	matchExact             // q is the whole name
+	matchPrefix            // The name starts with q ("gal" -> Gallery Pl-Chinatown)
+	matchWordPrefix        // A later word starts with q ("chin" -> Gallery Pl-Chinatown)
+	matchContains          // q is somewhere in the name
+)
+
+// searchRank returns how well a station matches the (already lowercased) query, false if it doesn't match
+func searchRank(station StationInfo, query string) (int, bool) {
+	name := strings.ToLower(station.Name)
+	switch {
+	case strings.EqualFold(station.Code, query):
+		return matchCode, true
+	case name == query:
+		return matchExact, true
+	case strings.HasPrefix(name, query):
+		return matchPrefix, true
+	}
+	// Words are split on anything that isn't a letter or digit, so "Pl-Chinatown" counts as two words
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || '0' <= r && r <= '9')
+	})
+	for _, word := range words {
+		if strings.HasPrefix(word, query) {
+			return matchWordPrefix, true
+		}
+	}
+	if strings.Contains(name, query) {
+		return matchContains, true
+	}
+	return 0, false
+}
+
+// searchStations returns up to limit stations matching query (case-insensitive), best matches first
+// A transfer complex shows up once: a station with the same name as an earlier result is skipped,
+// so "metro" lists Metro Center once rather than once per platform code.
+func searchStations(stations []StationInfo, query string, limit int) []StationInfo {
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	type match struct {
+		station StationInfo
+		rank    int
+	}
+	var matches []match
+	for _, station := range stations {
+		if rank, ok := searchRank(station, query); ok {
+			matches = append(matches, match{station: station, rank: rank})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].rank != matches[j].rank {
+			return matches[i].rank < matches[j].rank
+		}
+		return matches[i].station.Name < matches[j].station.Name
+	})
+
+	results := []StationInfo{} // Non-nil so no matches encodes as [] instead of null
+	seenNames := make(map[string]bool)
+	for _, m := range matches {
+		if len(results) == limit {
+			break
+		}
+		if seenNames[m.station.Name] {
+			continue
+		}
+		seenNames[m.station.Name] = true
+		results = append(results, m.station)
+	}
+	return results
+}
+
+// searchLimit works out how many results to return: ?limit= if given, but never more than searchResultLimit
+func searchLimit(r *http.Request) (int, error) {
+	limit := searchResultLimit
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		n, err := strconv.Atoi(limitParam)
+		if err != nil || n < 1 {
+			return 0, errors.New("limit must be a positive integer")
+		}
+		limit = min(n, searchResultLimit)
+	}
+	return limit, nil
+}
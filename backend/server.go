@@ -0,0 +1,77 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The HTTP server itself. http.ListenAndServe's default server has no timeouts at all,
+// so one slow (or malicious, "slow-loris") client could hold a connection open forever.
+
+// Overridable via SERVER_READ_TIMEOUT / SERVER_WRITE_TIMEOUT / SERVER_IDLE_TIMEOUT
+var (
+	serverReadTimeout  = 15 * time.Second  // Reading the whole request, headers and body
+	serverWriteTimeout = 60 * time.Second  // Writing the response. Generous since a cold cache can mean several WMATA calls
+	serverIdleTimeout  = 120 * time.Second // How long a keep-alive connection may sit unused between requests
+)
+
+// Where the built frontend lives, relative to the working directory. Overridable via FRONTEND_DIR,
+// and SERVE_FRONTEND=false turns static serving off entirely for API-only deployments.
+var (
+	frontendDir   = "../frontend"
+	serveFrontend = true
+)
+
+// registerFrontend serves the frontend's files at "/" (the API handlers are more specific, so they win)
+// If the directory isn't there, which usually means the server was started from another working directory,
+// that gets a startup warning and a JSON 404 saying what to set, instead of net/http's bare "404 page not found".
+func registerFrontend() {
+	if !serveFrontend {
+		slog.Info("frontend serving disabled", "var", "SERVE_FRONTEND")
+		http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, "Not found (API only, the frontend isn't served here)", http.StatusNotFound)
+		})
+		return
+	}
+
+	absDir, _ := filepath.Abs(frontendDir) // Only for the log line, so the error doesn't matter
+	if info, err := os.Stat(frontendDir); err != nil || !info.IsDir() {
+		slog.Warn("frontend directory not found, only the API will work",
+			"dir", absDir,
+			"hint", "run from backend/, set FRONTEND_DIR, or set SERVE_FRONTEND=false for API-only",
+		)
+		http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, "Frontend not found on the server (see FRONTEND_DIR)", http.StatusNotFound)
+		})
+		return
+	}
+
+	// This allows Go to serve index.html, script.js, style.css, etc.
+	http.Handle("/", http.FileServer(http.Dir(frontendDir)))
+	slog.Debug("serving frontend", "dir", absDir)
+}
+
+// newServer builds the server for ListenAndServe, using the handlers registered on http.DefaultServeMux
+func newServer(port string) *http.Server {
+	return &http.Server{
+		Addr:         ":" + port,
+		ReadTimeout:  serverReadTimeout,
+		WriteTimeout: serverWriteTimeout,
+		IdleTimeout:  serverIdleTimeout,
+	}
+}
+
+// clearConnDeadlines lifts the server's read/write timeouts for this one connection
+// For the long-lived /nexttrains/stream (SSE) and /ws/predictions (WebSocket) connections, which would
+// otherwise be cut off after serverWriteTimeout. Must be called before a WebSocket upgrade, since the
+// hijacked connection keeps whatever deadlines it had. Those handlers watch for dead clients themselves.
+func clearConnDeadlines(w http.ResponseWriter) error {
+	rc := http.NewResponseController(w) // Reaches through statusRecorder via its Unwrap method
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		return err
+	}
+	return rc.SetWriteDeadline(time.Time{}) // The zero time means "no deadline"
+}
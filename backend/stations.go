@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Helpers for reshaping station data (merging transfer complexes, etc)
+
+// stationLines returns the non-empty LineCode1-4 values of a station
+func stationLines(station StationInfo) []string {
+	var lines []string
+	for _, code := range []string{station.LineCode1, station.LineCode2, station.LineCode3, station.LineCode4} {
+		if code != "" {
+			lines = append(lines, code)
+		}
+	}
+	return lines
+}
+
+// findStation looks up a station by code
+func findStation(stations []StationInfo, code string) (StationInfo, bool) {
+	for _, station := range stations {
+		if station.Code == code {
+			return station, true
+		}
+	}
+	return StationInfo{}, false
+}
+
+// normalizeStationTogether cleans up StationTogether1/2 before stations go into the cache
+// Drops codes that point at the station itself, repeat each other, or aren't in the station list (those are
+// logged, as they mean WMATA's data is inconsistent), then moves a surviving StationTogether2 up into slot 1.
+// Edits the slice in place, so only call it on a fresh list that nothing else is reading yet.
+func normalizeStationTogether(stations []StationInfo) {
+	known := make(map[string]bool, len(stations))
+	for _, station := range stations {
+		known[station.Code] = true
+	}
+
+	for i := range stations {
+		station := &stations[i]
+		var together []string
+		for _, code := range []string{station.StationTogether1, station.StationTogether2} {
+			code = strings.TrimSpace(code)
+			switch {
+			case code == "", code == station.Code, len(together) > 0 && together[0] == code:
+				// Empty, a self-reference or a repeat: nothing to pair with
+			case !known[code]:
+				slog.Warn("station pairs with an unknown station, ignoring it", "station", station.Code, "together", code)
+			default:
+				together = append(together, code)
+			}
+		}
+		station.StationTogether1, station.StationTogether2 = "", ""
+		if len(together) > 0 {
+			station.StationTogether1 = together[0]
+		}
+		if len(together) > 1 {
+			station.StationTogether2 = together[1]
+		}
+	}
+}
+
+// mergeStations collapses transfer complexes (stations joined by StationTogether1/2) into one entry each
+// e.g. Metro Center is A01 (Red) + C01 (Blue/Orange/Silver), which becomes a single MergedStation.
+// Output keeps the order in which each complex first appears in the input.
+func mergeStations(stations []StationInfo) []MergedStation {
+	byCode := make(map[string]StationInfo, len(stations))
+	for _, station := range stations {
+		byCode[station.Code] = station
+	}
+
+	seen := make(map[string]bool, len(stations))
+	merged := []MergedStation{} // Non-nil so an empty station list encodes as [] instead of null
+	for _, station := range stations {
+		if seen[station.Code] {
+			continue
+		}
+
+		// Gather this station and every station it's paired with
+		group := []StationInfo{station}
+		seen[station.Code] = true
+		for _, together := range []string{station.StationTogether1, station.StationTogether2} {
+			if other, ok := byCode[together]; ok && !seen[together] {
+				group = append(group, other)
+				seen[together] = true
+			}
+		}
+
+		// Canonical = alphabetically lowest code, so the choice is stable across refreshes
+		sort.Slice(group, func(i, j int) bool { return group[i].Code < group[j].Code })
+		canonical := group[0]
+
+		m := MergedStation{
+			Code:    canonical.Code,
+			Name:    canonical.Name,
+			Address: canonical.Address,
+			Lat:     canonical.Lat,
+			Lon:     canonical.Lon,
+		}
+		lineSeen := make(map[string]bool)
+		for _, s := range group {
+			m.Codes = append(m.Codes, s.Code)
+			for _, line := range stationLines(s) {
+				if !lineSeen[line] {
+					lineSeen[line] = true
+					m.Lines = append(m.Lines, line)
+				}
+			}
+		}
+		merged = append(merged, m)
+	}
+	return merged
+}
+
+// withPairedCodes adds the StationTogether partners of each code (A01 -> A01, C01), keeping codes in order
+func withPairedCodes(stations []StationInfo, codes []string) []string {
+	seen := make(map[string]bool, len(codes))
+	var expanded []string
+	add := func(code string) {
+		if code = strings.TrimSpace(code); code != "" && !seen[code] {
+			seen[code] = true
+			expanded = append(expanded, code)
+		}
+	}
+	for _, code := range codes {
+		add(code)
+		if station, ok := findStation(stations, strings.TrimSpace(code)); ok {
+			add(station.StationTogether1)
+			add(station.StationTogether2)
+		}
+	}
+	return expanded
+}
+
+// parkingWithNames adds each station's name and total spaces to its parking info (/parking)
+// hasParkingOnly drops stations with no spaces at all (?hasParking=true). A code missing from the station list gets an empty name.
+func parkingWithNames(parking []StationParking, stations []StationInfo, hasParkingOnly bool) []ParkingWithName {
+	names := make(map[string]string, len(stations))
+	for _, station := range stations {
+		names[station.Code] = station.Name
+	}
+
+	enriched := make([]ParkingWithName, 0, len(parking))
+	for _, p := range parking {
+		total := p.AllDayParking.TotalCount + p.ShortTermParking.TotalCount
+		if hasParkingOnly && total == 0 {
+			continue
+		}
+		enriched = append(enriched, ParkingWithName{StationParking: p, Name: names[p.Code], TotalSpaces: total})
+	}
+	return enriched
+}
+
+// stationFieldIndex maps each StationInfo JSON field name (lowercased) to its struct field position
+// Built once with reflection (Go's way of inspecting struct types at runtime), e.g. "lat" -> 2.
+var stationFieldIndex = func() map[string]int {
+	index := make(map[string]int)
+	t := reflect.TypeOf(StationInfo{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		index[strings.ToLower(name)] = i
+	}
+	return index
+}()
+
+// projectStations keeps only the requested fields of each station (/stations?fields=Code,Name,Lat,Lon)
+// Field names are the JSON names from StationInfo, matched case-insensitively. Unknown names are an error.
+func projectStations(stations []StationInfo, fieldsParam string) ([]map[string]interface{}, error) {
+	type projectedField struct {
+		name  string // Canonical JSON name, used as the output key
+		index int
+	}
+
+	var fields []projectedField
+	t := reflect.TypeOf(StationInfo{})
+	for _, requested := range strings.Split(fieldsParam, ",") {
+		requested = strings.TrimSpace(requested)
+		if requested == "" {
+			continue
+		}
+		i, ok := stationFieldIndex[strings.ToLower(requested)]
+		if !ok {
+			return nil, fmt.Errorf("unknown field: %s", requested)
+		}
+		fields = append(fields, projectedField{name: t.Field(i).Tag.Get("json"), index: i})
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("fields must list at least one field")
+	}
+
+	projected := make([]map[string]interface{}, 0, len(stations))
+	for _, station := range stations {
+		v := reflect.ValueOf(station)
+		row := make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			row[field.name] = v.Field(field.index).Interface()
+		}
+		projected = append(projected, row)
+	}
+	return projected, nil
+}
+
+// writeStationsCSV writes stations as CSV with a header row (/stations.csv)
+// The Lines column is a space-joined list like "RD" or "BL OR SV".
+func writeStationsCSV(w io.Writer, stations []StationInfo) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"Code", "Name", "Lat", "Lon", "Lines", "City", "State", "Street", "Zip"}); err != nil {
+		return err
+	}
+	for _, station := range stations {
+		row := []string{
+			station.Code,
+			station.Name,
+			strconv.FormatFloat(station.Lat, 'f', -1, 64), // -1 = shortest exact representation
+			strconv.FormatFloat(station.Lon, 'f', -1, 64),
+			strings.Join(stationLines(station), " "),
+			station.Address.City,
+			station.Address.State,
+			station.Address.Street,
+			station.Address.Zip,
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush() // csv.Writer buffers, Flush sends the rest and reports any write error
+	return writer.Error()
+}
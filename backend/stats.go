@@ -0,0 +1,51 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Per-dataset summaries of the latest refresh, served at /stats.
+// The same numbers as the [Static] / [Predictions] log lines, but as JSON monitoring can read without parsing logs.
+
+var (
+	lastRefreshStats  = make(map[string]RefreshStats) // Dataset ("static", "predictions", "lines", ...) -> latest refresh
+	refreshStatsMutex sync.Mutex                      // Never held while taking another lock, so it's safe to use under cacheMutex
+)
+
+// recordRefreshStats stores how a refresh that started at start went
+// items is what's cached afterwards (nil after a failed refresh). Nil errors are skipped, so callers can pass
+// every step's error and only the real failures are counted.
+func recordRefreshStats(dataset string, start time.Time, items map[string]int, errs ...error) {
+	stats := RefreshStats{
+		FinishedAt: time.Now(),
+		DurationMs: time.Since(start).Milliseconds(),
+		Items:      items,
+	}
+	if stats.Items == nil {
+		stats.Items = map[string]int{} // Encode as {} rather than null
+	}
+	for _, err := range errs {
+		if err != nil {
+			stats.Errors++
+			stats.LastError = err.Error()
+		}
+	}
+	stats.Success = stats.Errors == 0
+
+	refreshStatsMutex.Lock()
+	lastRefreshStats[dataset] = stats
+	refreshStatsMutex.Unlock()
+}
+
+// refreshStatsSnapshot returns a copy of the latest stats, safe to encode without the lock
+// The Items maps are shared, which is fine since recordRefreshStats always stores a fresh one.
+func refreshStatsSnapshot() map[string]RefreshStats {
+	refreshStatsMutex.Lock()
+	defer refreshStatsMutex.Unlock()
+	snapshot := make(map[string]RefreshStats, len(lastRefreshStats))
+	for dataset, stats := range lastRefreshStats {
+		snapshot[dataset] = stats
+	}
+	return snapshot
+}
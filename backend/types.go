@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 // Station struct: like a struct in Rust, defines fields and their types
 type Station struct {
 	Name string `json:"Name"` // field maps to "Name" in JSON
@@ -61,6 +63,12 @@ type TrainPrediction struct {
 	LocationCode    string `json:"LocationCode"`
 	LocationName    string `json:"LocationName"`
 	Min             string `json:"Min"`
+
+	// Computed by us during refresh (not sent by WMATA), see parseMin in predictions.go
+	MinutesInt *int   `json:"MinutesInt"` // Minutes as a number, null for ARR/BRD/unknown
+	Status     string `json:"Status"`     // "boarding", "arriving", "enroute" or "unknown"
+	Suspect    bool   `json:"Suspect"`    // Min is implausible (e.g. "100" or junk), best not shown, see suspectMin
+	CarCount   *int   `json:"CarCount"`   // Car as a number (usually 6 or 8), null for "-" or blank, see parseCar
 }
 
 // TrainPredictionsResponse struct: Holds all train prediction responses
@@ -83,6 +91,119 @@ type LinesResponse struct {
 	Lines []Lines `json:"Lines"`
 }
 
+// ElevatorIncident struct: Info about an elevator or escalator that is out of service
+type ElevatorIncident struct {
+	UnitName                 string `json:"UnitName"`
+	UnitType                 string `json:"UnitType"` // "ELEVATOR" or "ESCALATOR"
+	StationCode              string `json:"StationCode"`
+	StationName              string `json:"StationName"`
+	LocationDescription      string `json:"LocationDescription"`
+	SymptomDescription       string `json:"SymptomDescription"`
+	DateOutOfServ            string `json:"DateOutOfServ"`
+	DateUpdated              string `json:"DateUpdated"`
+	EstimatedReturnToService string `json:"EstimatedReturnToService"`
+}
+
+// ElevatorIncidentsResponse struct: Holds all elevator/escalator outages
+type ElevatorIncidentsResponse struct {
+	ElevatorIncidents []ElevatorIncident `json:"ElevatorIncidents"`
+}
+
+// Incident struct: Info about a rail incident (delays, single-tracking, etc)
+type Incident struct {
+	IncidentID    string `json:"IncidentID"`
+	Description   string `json:"Description"`
+	IncidentType  string `json:"IncidentType"`  // e.g. "Delay", "Alert"
+	LinesAffected string `json:"LinesAffected"` // Semicolon-delimited, e.g. "RD;" or "BL; OR;"
+	DateUpdated   string `json:"DateUpdated"`
+}
+
+// IncidentsResponse struct: Holds all rail incidents
+type IncidentsResponse struct {
+	Incidents []Incident `json:"Incidents"`
+}
+
+// PathItem struct: One station along the path between two stations on a line
+type PathItem struct {
+	LineCode       string `json:"LineCode"`
+	StationCode    string `json:"StationCode"`
+	StationName    string `json:"StationName"`
+	SeqNum         int    `json:"SeqNum"`         // Order along the path, starting at 1
+	DistanceToPrev int    `json:"DistanceToPrev"` // In feet, 0 for the first station
+}
+
+// PathResponse struct: Holds the ordered stations between two stations
+type PathResponse struct {
+	Path []PathItem `json:"Path"`
+}
+
+// RailFare struct: Fares in dollars for one trip
+type RailFare struct {
+	PeakTime       float64 `json:"PeakTime"`
+	OffPeakTime    float64 `json:"OffPeakTime"`
+	SeniorDisabled float64 `json:"SeniorDisabled"` // Reduced fare for seniors and riders with disabilities
+}
+
+// StationToStation struct: Distance, rail travel time and fares between two stations
+type StationToStation struct {
+	SourceStation      string   `json:"SourceStation"`
+	DestinationStation string   `json:"DestinationStation"`
+	CompositeMiles     float64  `json:"CompositeMiles"`
+	RailTime           int      `json:"RailTime"` // Minutes on the train (no walking or waiting)
+	RailFare           RailFare `json:"RailFare"`
+}
+
+// StationToStationResponse struct: Holds the station-to-station info (one entry when both codes are given)
+type StationToStationResponse struct {
+	StationToStationInfos []StationToStation `json:"StationToStationInfos"`
+}
+
+// BusPrediction struct: Info about the next bus arrivals at a stop
+type BusPrediction struct {
+	RouteID       string `json:"RouteID"`
+	DirectionText string `json:"DirectionText"` // e.g. "North to Silver Spring Station"
+	Minutes       int    `json:"Minutes"`
+	TripID        string `json:"TripID"`
+	VehicleID     string `json:"VehicleID"`
+}
+
+// BusPredictionsResponse struct: Holds all bus predictions for one stop
+type BusPredictionsResponse struct {
+	Predictions []BusPrediction `json:"Predictions"`
+	StopName    string          `json:"StopName"`
+}
+
+// TrainTime struct: A scheduled first or last train from a station
+type TrainTime struct {
+	Time               string `json:"Time"`               // "HH:MM", 24-hour
+	DestinationStation string `json:"DestinationStation"` // Station code the train is heading to
+}
+
+// DaySchedule struct: Opening time and first/last trains for one day of the week
+type DaySchedule struct {
+	OpeningTime string      `json:"OpeningTime"`
+	FirstTrains []TrainTime `json:"FirstTrains"`
+	LastTrains  []TrainTime `json:"LastTrains"`
+}
+
+// StationTime struct: A station's weekly opening and first/last train schedule
+type StationTime struct {
+	Code        string      `json:"Code"`
+	StationName string      `json:"StationName"`
+	Monday      DaySchedule `json:"Monday"`
+	Tuesday     DaySchedule `json:"Tuesday"`
+	Wednesday   DaySchedule `json:"Wednesday"`
+	Thursday    DaySchedule `json:"Thursday"`
+	Friday      DaySchedule `json:"Friday"`
+	Saturday    DaySchedule `json:"Saturday"`
+	Sunday      DaySchedule `json:"Sunday"`
+}
+
+// StationTimesResponse struct: Holds schedules for all stations
+type StationTimesResponse struct {
+	StationTimes []StationTime `json:"StationTimes"`
+}
+
 /*
 Parking information will not be used for now as this project focuses on accessibility and walkability.
 It might be used in the future for visualisations on the site, or to see how "car-dependant" a station is.
@@ -119,3 +240,244 @@ type StationParking struct {
 type StationsParkingResponse struct {
 	StationsParking []StationParking `json:"StationsParking"`
 }
+
+/*
+Response types below are built by this server (not returned by WMATA).
+*/
+
+// Envelope struct: The opt-in wrapper for /stations, /nexttrains, /lines and /parking (?envelope=true), see withEnvelope
+type Envelope struct {
+	Data        interface{} `json:"data"`        // Exactly what the endpoint returns without ?envelope=true
+	GeneratedAt time.Time   `json:"generatedAt"` // When the data was fetched from WMATA, RFC3339 in UTC
+}
+
+// ParkingWithName struct: A station's parking plus its name and total spaces (/parking)
+type ParkingWithName struct {
+	StationParking
+	Name        string `json:"Name"`
+	TotalSpaces int    `json:"TotalSpaces"` // AllDayParking.TotalCount + ShortTermParking.TotalCount
+}
+
+// ErrorResponse struct: Body of every error response (see writeError)
+type ErrorResponse struct {
+	Error string `json:"error"`
+	Code  int    `json:"code"` // Same as the HTTP status code
+}
+
+// HealthResponse struct: Cache freshness report returned by /health
+type HealthResponse struct {
+	Status                    string    `json:"status"` // "ok", "warming" or "stale"
+	StaticCacheTime           time.Time `json:"staticCacheTime"`
+	StaticCacheAgeSeconds     float64   `json:"staticCacheAgeSeconds"`
+	PredictionCacheTime       time.Time `json:"predictionCacheTime"`
+	PredictionCacheAgeSeconds float64   `json:"predictionCacheAgeSeconds"`
+	CachedStations            int       `json:"cachedStations"`
+	ExpectedStations          int       `json:"expectedStations"` // How many jStations listed, more than cachedStations when some details failed
+	MissingStations           []string  `json:"missingStations"`  // Those stations' codes, see missingStationCodes
+	StaticChecksum            string    `json:"staticChecksum"`   // SHA-256 of the static caches, changes when WMATA's data does
+	CachedPredictions         int       `json:"cachedPredictions"`
+	Warming                   struct {
+		Static      bool `json:"static"`
+		Predictions bool `json:"predictions"`
+	} `json:"warming"` // true while that cache's startup pre-warm is still running
+	Datasets map[string]DatasetStatus `json:"datasets"` // Per static dataset: "stations", "entrances", "lines", "parking", "stationTimes"
+	APIKeys  []APIKeyStatus           `json:"apiKeys"`
+	// Per background loop ("Predictions", "Static Data"): how many runs in a row have failed or panicked
+	RefreshFailures map[string]int `json:"refreshFailures"`
+}
+
+// RefreshStats struct: How the latest refresh of one dataset went (/stats), see recordRefreshStats
+type RefreshStats struct {
+	Success    bool           `json:"success"` // No errors at all, a partly failed static refresh counts as false
+	FinishedAt time.Time      `json:"finishedAt"`
+	DurationMs int64          `json:"durationMs"`
+	Items      map[string]int `json:"items"`               // What's cached afterwards, e.g. {"trains": 412}. Empty after a failure
+	Errors     int            `json:"errors"`              // Failed fetches during this refresh
+	LastError  string         `json:"lastError,omitempty"` // The last of those errors
+}
+
+// AdminRefreshResponse struct: What /admin/refresh refreshed, and the cache timestamps afterwards
+type AdminRefreshResponse struct {
+	Target              string    `json:"target"` // "stations", "predictions" or "all"
+	StaticCacheTime     time.Time `json:"staticCacheTime"`
+	PredictionCacheTime time.Time `json:"predictionCacheTime"`
+}
+
+// APIKeyStatus struct: How one configured WMATA key is doing (/health). By position, never the key itself.
+type APIKeyStatus struct {
+	Index    int  `json:"index"`    // Position in WMATA_API_KEY
+	Failures int  `json:"failures"` // Consecutive 429/401/403 responses
+	Skipped  bool `json:"skipped"`  // Being skipped for now, calls go to the other keys
+}
+
+// DatasetStatus struct: When one static dataset was last fetched, and whether its latest fetch failed (/health)
+type DatasetStatus struct {
+	LastSuccess time.Time `json:"lastSuccess"`
+	LastAttempt time.Time `json:"lastAttempt"`
+	Failing     bool      `json:"failing"` // The latest attempt failed, so the previous copy is being served
+}
+
+// NearbyStation struct: A station plus its distance from a requested point (/nearest, /walkshed)
+// Embedding StationInfo means its fields are flattened into the same JSON object.
+type NearbyStation struct {
+	StationInfo
+	DistanceMeters float64  `json:"DistanceMeters"`
+	Lines          []string `json:"Lines"` // Non-empty LineCode1-4, for convenience
+}
+
+// NearbyEntrance struct: An entrance plus its distance from a requested point (/entrances?lat=&lon=)
+type NearbyEntrance struct {
+	StationEntrance
+	DistanceMeters float64 `json:"DistanceMeters"`
+}
+
+// LineWithTerminals struct: A line plus the names of its terminal stations and its colour (/lines)
+// Embedding Lines keeps every WMATA field, the names are just added alongside.
+type LineWithTerminals struct {
+	Lines
+	StartStationName string `json:"StartStationName"`
+	EndStationName   string `json:"EndStationName"`
+	ColorHex         string `json:"ColorHex"` // Official line colour like "#BF0D3E", see lineColors
+}
+
+// LineColor struct: A line's official name and colour (/lines/colors)
+type LineColor struct {
+	LineCode string `json:"LineCode"`
+	Name     string `json:"Name"`     // "Red", "Blue", ...
+	ColorHex string `json:"ColorHex"` // "#RRGGBB"
+}
+
+// MergedStation struct: One logical station for a transfer complex (/stations?merge=true)
+// Code is the canonical code: the alphabetically lowest of the pair (Metro Center = "A01", not "C01").
+// Name, Address, Lat and Lon come from the canonical station.
+type MergedStation struct {
+	Code    string   `json:"Code"`
+	Codes   []string `json:"Codes"` // Every code in the complex, canonical first
+	Name    string   `json:"Name"`
+	Address Address  `json:"Address"`
+	Lat     float64  `json:"Lat"`
+	Lon     float64  `json:"Lon"`
+	Lines   []string `json:"Lines"` // Deduplicated LineCode1-4 across all codes
+}
+
+// StationDetail struct: Everything about one station in a single response (/station?code=)
+type StationDetail struct {
+	Station     StationInfo       `json:"Station"`
+	Entrances   []StationEntrance `json:"Entrances"`
+	Parking     *StationParking   `json:"Parking"` // null if WMATA has no parking info for the station
+	Lines       []Lines           `json:"Lines"`   // Lines serving the station (from LineCode1-4)
+	Predictions []TrainPrediction `json:"Predictions"`
+}
+
+// LineStations struct: A line's stations in order from StartStationCode to EndStationCode
+type LineStations struct {
+	LineCode    string        `json:"LineCode"`
+	DisplayName string        `json:"DisplayName"`
+	Stations    []StationInfo `json:"Stations"`
+	Branches    []LineBranch  `json:"Branches"` // Runs to internal destinations off the main run (usually empty)
+}
+
+// LineBranch struct: Ordered stations from a line's start to one of its internal destinations
+type LineBranch struct {
+	ToStationCode string        `json:"ToStationCode"`
+	Stations      []StationInfo `json:"Stations"`
+}
+
+// PredictionGroup struct: The next trains to one destination from one track (/nexttrains?code=&grouped=true)
+type PredictionGroup struct {
+	DestinationCode string            `json:"DestinationCode"`
+	DestinationName string            `json:"DestinationName"`
+	Group           string            `json:"Group"` // Track/platform group, "1" or "2"
+	Line            string            `json:"Line"`
+	Trains          []TrainPrediction `json:"Trains"`   // Up to 3, soonest first
+	Headways        []int             `json:"Headways"` // Minutes between consecutive Trains (ARR/BRD = 0)
+}
+
+// BoardRow struct: One line of a station display, the next trains from one track (/nexttrains?code=&board=true)
+type BoardRow struct {
+	Group  string            `json:"Group"`  // Track/platform group, "1" or "2"
+	Trains []TrainPrediction `json:"Trains"` // Up to 3, soonest first, any destination
+}
+
+// StationPredictions struct: The trains at one transfer complex, every platform together (/nexttrains?merge=true)
+type StationPredictions struct {
+	Code   string            `json:"Code"`  // Canonical code, like MergedStation
+	Codes  []string          `json:"Codes"` // Every platform code in the complex
+	Name   string            `json:"Name"`
+	Trains []TrainPrediction `json:"Trains"` // Soonest first, each keeps its own LocationCode and Group
+}
+
+// LineCarSummary struct: Average train length per line at a station, a rough crowding hint (/nexttrains?summary=true)
+type LineCarSummary struct {
+	Line        string  `json:"Line"`
+	Trains      int     `json:"Trains"`      // Trains with a known car count (the ones averaged)
+	AverageCars float64 `json:"AverageCars"` // 0 if no train on this line reported its length
+}
+
+// GeoJSONFeatureCollection struct: A GeoJSON FeatureCollection (the top-level object of a .geojson file)
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"` // Always "FeatureCollection"
+	Features []GeoJSONFeature `json:"features"`
+}
+
+// GeoJSONFeature struct: One GeoJSON feature (a shape plus its properties)
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"` // Always "Feature"
+	Geometry   GeoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// GeoJSONGeometry struct: A GeoJSON geometry. Coordinates is interface{} because its shape depends on
+// Type: [lon, lat] for a Point, [[lon, lat], ...] for a LineString, and so on.
+type GeoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// AccessibleEntrance struct: An entrance plus whether its station's elevators are working (/entrances?accessible=true)
+type AccessibleEntrance struct {
+	StationEntrance
+	ElevatorsInService bool `json:"ElevatorsInService"` // false if any elevator at the station is out (per ElevatorIncidents)
+}
+
+// StationAccessibility struct: Elevator/escalator outages at one station, and whether step-free access is likely (/accessibility)
+type StationAccessibility struct {
+	Code                    string `json:"Code"`
+	Name                    string `json:"Name"`
+	Elevators               int    `json:"Elevators"` // Estimated, WMATA doesn't publish it (see stationElevatorCounts)
+	ElevatorsOut            int    `json:"ElevatorsOut"`
+	EscalatorsOut           int    `json:"EscalatorsOut"`
+	StepFreeAccessAvailable bool   `json:"StepFreeAccessAvailable"` // false only if every elevator is out, see stationAccessibility
+}
+
+// SnapshotResponse struct: Everything the map needs on page load in one response (/snapshot)
+type SnapshotResponse struct {
+	Stations    []StationInfo     `json:"Stations"`
+	Lines       []Lines           `json:"Lines"`
+	Predictions []TrainPrediction `json:"Predictions,omitzero"` // Left out entirely with ?predictions=false
+}
+
+// PredictionChange struct: One train that appeared, disappeared or changed Min between two snapshots (/nexttrains/diff)
+type PredictionChange struct {
+	Change          string `json:"Change"` // "added", "removed" or "changed"
+	LocationCode    string `json:"LocationCode"`
+	Group           string `json:"Group"`
+	Line            string `json:"Line"`
+	DestinationCode string `json:"DestinationCode"`
+	DestinationName string `json:"DestinationName"`
+	OldMin          string `json:"OldMin"` // Empty for "added"
+	NewMin          string `json:"NewMin"` // Empty for "removed"
+}
+
+// PredictionDiff struct: What changed between the two most recent prediction snapshots (/nexttrains/diff)
+type PredictionDiff struct {
+	From    time.Time          `json:"From"` // The older snapshot's time
+	To      time.Time          `json:"To"`
+	Changes []PredictionChange `json:"Changes"`
+}
+
+// PredictionSnapshot struct: The predictions from one refresh, and when it happened (/nexttrains/history)
+type PredictionSnapshot struct {
+	Time        time.Time         `json:"Time"`
+	Predictions []TrainPrediction `json:"Predictions"`
+}
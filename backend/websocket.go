@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket endpoint for live predictions (/ws/predictions), for clients that can't use SSE easily.
+// On connect the client gets the current predictions, then a new message after every cache refresh
+// (pushed by the predictionUpdates broadcaster).
+// The client can send a text message with station codes (e.g. "A01" or "A01,C01") to filter the feed;
+// the first one usually comes right after connecting, and any later one replaces the filter.
+
+// wsUpgrader turns a normal HTTP request into a WebSocket connection
+var wsUpgrader = websocket.Upgrader{
+	// Same policy as our CORS headers: any origin may read this public, read-only data
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+const wsWriteTimeout = 10 * time.Second // Give up on a client that can't take a message within this time
+
+func handlePredictionsWebSocket(w http.ResponseWriter, r *http.Request, key string) {
+	// Long-lived like SSE, so lift the server's timeouts first (see server.go). Writes still get wsWriteTimeout below.
+	if err := clearConnDeadlines(w); err != nil {
+		requestLogger(r).Warn("could not clear connection deadlines", "err", err)
+	}
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		requestLogger(r).Warn("websocket upgrade failed", "err", err)
+		return // Upgrade already wrote an HTTP error response
+	}
+	defer conn.Close()
+
+	// Reader goroutine: gorilla allows one reader and one writer at a time, so all reads happen here
+	// and filter changes are handed to the writer loop below through a channel.
+	filters := make(chan []string)
+	closed := make(chan struct{})     // Closed by the reader when the client goes away
+	writerDone := make(chan struct{}) // Closed by the writer loop when it exits, so the reader never blocks forever
+	defer close(writerDone)
+	go func() {
+		defer close(closed)
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return // Client went away (or sent garbage), stop the writer too
+			}
+			var codes []string
+			if text := strings.TrimSpace(string(message)); text != "" {
+				codes = strings.Split(text, ",")
+			}
+			select {
+			case filters <- codes:
+			case <-writerDone:
+				return
+			}
+		}
+	}()
+
+	// Subscribe BEFORE reading the current cache, so a refresh in between can't be missed
+	updates := predictionUpdates.Subscribe()
+	defer predictionUpdates.Unsubscribe(updates)
+
+	predictions, _ := predictionCache.Get(cacheKeyAll)
+
+	var stationCodes []string
+	send := func() error {
+		filtered := predictions
+		if stationCodes != nil {
+			filtered = filterPredictionsByCode(predictions, stationCodes)
+		}
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		return conn.WriteJSON(sortPredictions(filtered))
+	}
+
+	if err := send(); err != nil {
+		return
+	}
+	for {
+		select {
+		case <-closed:
+			return
+		case codes := <-filters:
+			stationCodes = codes // Resend straight away with the new filter
+		case predictions = <-updates: // Cache refreshed (see broadcast.go)
+		}
+		if err := send(); err != nil {
+			return
+		}
+	}
+}
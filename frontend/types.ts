@@ -45,4 +45,8 @@ export interface TrainPrediction {
     LocationCode: string;
     LocationName: string;
     Min: string; // String because "2","BRD" (Boarding), "ARR" (Arriving).
+    MinutesInt: number | null; // Parsed by the backend, null for ARR/BRD/unknown
+    Status: "boarding" | "arriving" | "enroute" | "unknown";
+    Suspect: boolean; // Implausible Min (e.g. "100" or junk), flagged by the backend
+    CarCount: number | null; // Parsed from Car by the backend, null for "-" or blank
 }
@@ -5,6 +5,8 @@ import { DEST_EXPANSIONS } from './utils.js';
 
 // Build HTML for train predictions with styling
 export function buildTrainPredictionsHTML(trains: TrainPrediction[]): string {
+    // Drop predictions the backend flagged as implausible (e.g. "100 min")
+    trains = trains.filter(train => !train.Suspect);
     if (trains.length === 0) {
         return `<div style="margin-top: 16px; padding: 12px; background: #f5f5f5; border-radius: 4px;">
             <p style="margin: 0; color: #666;"><em>No trains currently predicted</em></p>